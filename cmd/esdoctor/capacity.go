@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"esdoctor/diagnosis"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type prepareFunc = func(cmd *cobra.Command) (diagnosis.CommentWriter, error)
+
+func CapacityCommand(prepare prepareFunc) *cobra.Command {
+
+	cmd := cobra.Command{
+		Use:           "capacity <JSON_DUMP_FILE> <JSON_DUMP_FILE>...",
+		Short:         "projects disk growth out of json dumps collected over time",
+		Args:          cobra.MinimumNArgs(2),
+		SilenceErrors: true,
+	}
+
+	cmd.Long = "" +
+		"Fits the disk growth of each data node and index out of a series of json dumps (as " +
+		"generated with -f json-dump) collected over time, and projects when each node crosses the " +
+		"high disk watermark, when the cluster runs out of disk and how many data nodes are needed to " +
+		"absorb the growth within the planning horizon. The more dumps and the longer the period they " +
+		"cover, the more accurate the projections.\n\n" +
+		"Printing format is controlled with the same flags as the main command"
+
+	cmd.Example = strings.Join([]string{
+		"1. Collects a json dump, eg daily from a cron job",
+		"  esdoctor https://some.address:9200 -f json-dump > dumps/$(date +%F).json",
+		"2. Projects growth out of all collected dumps",
+		"  esdoctor capacity dumps/*.json -A",
+		"3. Projects growth over the next 180 days",
+		"  esdoctor capacity dumps/*.json -A --horizon-days 180",
+	}, "\n")
+
+	var horizonDays int
+	cmd.Flags().IntVar(
+		&horizonDays, "horizon-days", 90,
+		"How many days into the future to plan capacity for",
+	)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if horizonDays <= 0 {
+			return errors.New("the planning horizon needs to be of at least one day")
+		}
+		writer, err := prepare(cmd)
+		if err != nil {
+			return err
+		}
+
+		history := []*diagnosis.Diagnostics{}
+		for _, path := range args {
+			log.Debugf("Loading json dump %s", path)
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			d, err := diagnosis.LoadJSONDump(file)
+			file.Close()
+			if err != nil {
+				return fmt.Errorf("failed to load json dump %s: %w", path, err)
+			}
+			history = append(history, d)
+		}
+
+		_, err = diagnosis.PlanCapacity(
+			history,
+			diagnosis.WithOutput(writer),
+			diagnosis.WithPlanningHorizon(time.Duration(horizonDays)*24*time.Hour),
+		)
+		return err
+	}
+
+	return &cmd
+}
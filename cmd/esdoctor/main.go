@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"esdoctor/client"
 	"esdoctor/diagnosis"
@@ -59,6 +60,8 @@ func Command() *cobra.Command {
 		"  esdoctor https://some.address:9200 -f json",
 		"5. Runs diagnostics, dumping the whole diagnosis state as json",
 		"  esdoctor https://some.address:9200 -f json-dump",
+		"6. Runs diagnostics, also calculating per second rates from two stats samples 30s apart",
+		"  esdoctor https://some.address:9200 -A --sampling-interval 30s",
 	}, "\n")
 
 	var verbosity int
@@ -117,12 +120,31 @@ func Command() *cobra.Command {
 			"Also check the --info, --summary, --advice and --warning flags",
 	)
 
-	cmd.RunE = func(cmd *cobra.Command, args []string) error {
-		var writer diagnosis.CommentWriter
+	var samplingInterval time.Duration
+	cmd.Flags().DurationVar(
+		&samplingInterval, "sampling-interval", 0,
+		"Fetches nodes and indices stats twice, this interval apart, to calculate per second rates "+
+			"(eg 30s). Without it, only counters accumulated since nodes started are available",
+	)
+
+	var maxSnapshotAge time.Duration
+	cmd.Flags().DurationVar(
+		&maxSnapshotAge, "max-snapshot-age", 24*time.Hour,
+		"Warns when the last successful snapshot is older than this",
+	)
+
+	var retentionDays int
+	cmd.Flags().IntVar(
+		&retentionDays, "retention-days", 90,
+		"Advises deleting time series indices created more than this many days ago. 0 disables it",
+	)
+
+	// builds the comment writer according to the format flags
+	newWriter := func() (diagnosis.CommentWriter, error) {
 		if format == "json" || jsonFormat {
-			writer = diagnosis.NewJSONCommentWriter(os.Stdout, false)
+			return diagnosis.NewJSONCommentWriter(os.Stdout, false), nil
 		} else if format == "json-dump" || jsonDumpFormat {
-			writer = diagnosis.NewJSONCommentWriter(os.Stdout, true)
+			return diagnosis.NewJSONCommentWriter(os.Stdout, true), nil
 		} else if format == "text" {
 			var types []diagnosis.CommentType
 			if !allTypes {
@@ -142,32 +164,54 @@ func Command() *cobra.Command {
 			}
 
 			if types != nil && len(types) == 0 {
-				return errors.New(
+				return nil, errors.New(
 					"need to specify at least one level of comments to be printed when running with text format. " +
 						"Use -A for all comments or a combination of the -i, -s, -a and -w flags",
 				)
 			}
-			writer = diagnosis.NewTextCommentWriter(os.Stdout, types, true)
-		} else {
-			return fmt.Errorf("unrecognized format %q", format)
+			return diagnosis.NewTextCommentWriter(os.Stdout, types, true), nil
+		}
+		return nil, fmt.Errorf("unrecognized format %q", format)
+	}
+
+	// validates the flags shared by all commands, returning the comment writer to use
+	prepare := func(cmd *cobra.Command) (diagnosis.CommentWriter, error) {
+		writer, err := newWriter()
+		if err != nil {
+			return nil, err
 		}
 
 		// From now forward any failures are execution failures and not usage errors. Setting this
 		// will suprress printing the error as an usage error
-		cmd.SilenceUsage = true
+		cmd.Root().SilenceUsage = true
 
 		setupLogging(verbosity)
-		endpoint := args[0]
+		return writer, nil
+	}
+
+	// creates a client for the given endpoint
+	connect := func(endpoint string) (client.Versioned, error) {
 		clientOpts := []client.Option{}
 		if log.IsLevelEnabled(log.TraceLevel) {
 			clientOpts = append(clientOpts, client.WithBodyLogging())
 		}
-		client, err := client.New(endpoint, clientOpts...)
+		return client.New(endpoint, clientOpts...)
+	}
+
+	// runs the diagnosis over the given endpoint, shared by the root command and subcommands
+	run := func(cmd *cobra.Command, endpoint string, options ...diagnosis.Option) error {
+		writer, err := prepare(cmd)
 		if err != nil {
 			return err
 		}
 
-		diagnosis, err := diagnosis.Diagnose(cmd.Context(), client, diagnosis.WithOutput(writer))
+		client, err := connect(endpoint)
+		if err != nil {
+			return err
+		}
+
+		options = append([]diagnosis.Option{diagnosis.WithOutput(writer)}, options...)
+		diagnosis, err := diagnosis.Diagnose(cmd.Context(), client, options...)
 
 		if diagnosis != nil {
 			diagnosis.Comments()
@@ -176,6 +220,33 @@ func Command() *cobra.Command {
 		return err
 	}
 
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if samplingInterval < 0 {
+			return fmt.Errorf("invalid sampling interval %v", samplingInterval)
+		}
+		if maxSnapshotAge <= 0 {
+			return fmt.Errorf("invalid max snapshot age %v", maxSnapshotAge)
+		}
+		if retentionDays < 0 {
+			return fmt.Errorf("invalid retention of %d days", retentionDays)
+		}
+		return run(
+			cmd, args[0],
+			diagnosis.WithSamplingInterval(samplingInterval),
+			diagnosis.WithMaxSnapshotAge(maxSnapshotAge),
+			diagnosis.WithRetention(time.Duration(retentionDays)*24*time.Hour),
+		)
+	}
+
+	cmd.AddCommand(SimulateCommand(run))
+	cmd.AddCommand(CapacityCommand(prepare))
+	cmd.AddCommand(RebalanceCommand(func(cmd *cobra.Command, endpoint string) (client.Versioned, error) {
+		// the output of this command is the rebalance plan, so the format flags do not apply
+		cmd.Root().SilenceUsage = true
+		setupLogging(verbosity)
+		return connect(endpoint)
+	}))
+
 	return &cmd
 }
 
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"esdoctor/client"
+	"esdoctor/diagnosis"
+	"esdoctor/metadata"
+	"esdoctor/util"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type connectFunc = func(cmd *cobra.Command, endpoint string) (client.Versioned, error)
+
+func RebalanceCommand(connect connectFunc) *cobra.Command {
+
+	cmd := cobra.Command{
+		Use:           "rebalance <ELASTICSEARCH_HTTP_ENDPOINT>",
+		Short:         "plans shard moves balancing the disk usage of data nodes",
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+	}
+
+	cmd.Long = fmt.Sprintf(""+
+		"Computes a small set of shard moves bringing the disk usage of data nodes within %d%% of "+
+		"the median, honoring the same shard and allocation awareness constraints and the low disk "+
+		"watermark, and prints it as the body of a _cluster/reroute request. The plan is not "+
+		"executed unless the --execute flag is passed.\n\n"+
+		"Note that the balancer balances shard counts rather than disk usage, so it may move some "+
+		"shards back",
+		diagnosis.RebalanceTolerancePercent,
+	)
+
+	cmd.Example = strings.Join([]string{
+		"1. Prints the rebalance plan",
+		"  esdoctor rebalance https://some.address:9200 > plan.json",
+		"2. Runs a reviewed plan",
+		"  curl -XPOST -H 'Content-Type: application/json' https://some.address:9200/_cluster/reroute -d @plan.json",
+		"3. Computes and runs the plan right away",
+		"  esdoctor rebalance https://some.address:9200 --execute",
+	}, "\n")
+
+	var execute bool
+	cmd.Flags().BoolVar(
+		&execute, "execute", false,
+		"Runs the plan with the _cluster/reroute api. ATTENTION: this relocates shards in the cluster",
+	)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		client, err := connect(cmd, args[0])
+		if err != nil {
+			return err
+		}
+		d, err := diagnosis.Load(cmd.Context(), client, diagnosis.WithOutput(nil))
+		if err != nil {
+			return err
+		}
+
+		plan := d.PlanRebalance()
+		log.Infof(
+			"Planned %d shard moves, moving %s. Balanced within %d%% of the median: %t",
+			len(plan.Commands.Commands), util.HumanizeBytes(plan.MovedBytes), diagnosis.RebalanceTolerancePercent,
+			plan.Balanced,
+		)
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(plan.Commands); err != nil {
+			return err
+		}
+
+		if !execute || len(plan.Commands.Commands) == 0 {
+			return nil
+		}
+		log.Warnf("Executing %d shard moves", len(plan.Commands.Commands))
+		result, err := metadata.Reroute(cmd.Context(), client, &plan.Commands)
+		if err != nil {
+			return err
+		}
+		if !result.Acknowledged {
+			log.Warn("The reroute request was not acknowledged, check the cluster for ongoing relocations")
+		}
+		return nil
+	}
+
+	return &cmd
+}
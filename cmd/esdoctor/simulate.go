@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"esdoctor/diagnosis"
+
+	"github.com/spf13/cobra"
+)
+
+type runFunc = func(cmd *cobra.Command, endpoint string, options ...diagnosis.Option) error
+
+func SimulateCommand(run runFunc) *cobra.Command {
+
+	cmd := cobra.Command{
+		Use:           "simulate <ELASTICSEARCH_HTTP_ENDPOINT>",
+		Short:         "simulates what happens to the cluster if some nodes go down",
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+	}
+
+	cmd.Long = "" +
+		"Simulates losing some nodes of an Elasticsearch cluster, either by name or by zone, and " +
+		"prints which indices would turn red or yellow, how much data would need to be re-replicated " +
+		"and whether the remaining data nodes have enough disk headroom (below the low disk watermark) " +
+		"to absorb it. Nothing is changed in the cluster. Useful before maintenance windows.\n\n" +
+		"Printing format is controlled with the same flags as the main command"
+
+	cmd.Example = strings.Join([]string{
+		"1. Simulates losing a node",
+		"  esdoctor simulate https://some.address:9200 -A --lose-node node-1",
+		"2. Simulates losing two nodes",
+		"  esdoctor simulate https://some.address:9200 -A --lose-node node-1,node-2",
+		"3. Simulates losing all nodes of a zone, given by the allocation awareness attribute",
+		"  esdoctor simulate https://some.address:9200 -A --lose-zone us-east-1a",
+		"4. Simulates losing all nodes with the rack node attribute set to r1",
+		"  esdoctor simulate https://some.address:9200 -A --lose-zone r1 --zone-attribute rack",
+	}, "\n")
+
+	var loseNodes []string
+	cmd.Flags().StringSliceVar(
+		&loseNodes, "lose-node", nil,
+		"Name of a node to simulate losing. Can be specified multiple times or as a comma separated list",
+	)
+
+	var loseZone string
+	cmd.Flags().StringVar(
+		&loseZone, "lose-zone", "",
+		"Zone whose nodes to simulate losing",
+	)
+
+	var zoneAttribute string
+	cmd.Flags().StringVar(
+		&zoneAttribute, "zone-attribute", "",
+		"Node attribute holding the zone of the nodes. Defaults to the allocation awareness attribute",
+	)
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if len(loseNodes) == 0 && loseZone == "" {
+			return errors.New("need to specify the nodes to lose with --lose-node and/or --lose-zone")
+		}
+		return run(cmd, args[0], diagnosis.WithSimulation(diagnosis.Simulation{
+			LoseNodes:     loseNodes,
+			LoseZone:      loseZone,
+			ZoneAttribute: zoneAttribute,
+		}))
+	}
+
+	return &cmd
+}
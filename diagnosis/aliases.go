@@ -0,0 +1,220 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"esdoctor/metadata"
+)
+
+const I067_Alias = "I067: " +
+	"Alias %s points to %d indices (%s), %s"
+
+const I068_DataStream = "I068: " +
+	"Data stream %s has %d backing indices (generation %d), writing to %s"
+
+const S067_AliasesAndDataStreams = "S067: " +
+	"%d aliases and %d data streams, with %d backing indices"
+
+const W067_RolloverAliasWithoutWriteIndex = "W067: " +
+	"Rollover alias %s points to %d indices but none of them is its write index, so writing through " +
+	"it and rolling it over fail. Mark the latest index as the write index with POST _aliases " +
+	"{\"actions\": [{\"add\": {\"index\": %q, \"alias\": %q, \"is_write_index\": true}}]}"
+
+const A067_AliasWithoutWriteIndex = "A067: " +
+	"Alias %s points to %d indices but none of them is its write index, so writing through it " +
+	"fails. This is fine if it is only used for searching, otherwise set is_write_index on one of them"
+
+const A068_AliasSpansManyIndices = "A068: " +
+	"Alias %s spans %d indices with %d shards in total. Every search through it fans out to all of " +
+	"them, which is slow and puts pressure on the search thread pool. Narrow the alias down to the " +
+	"indices actually searched, or use fewer and larger indices"
+
+const W069_DataStreamInconsistentSettings = "W069: " +
+	"Backing indices of data stream %s have different %s: %s. They are meant to be created from " +
+	"the same template. Check whether the template changed, or the settings were updated on some of them"
+
+const W070_OrphanedRolloverAlias = "W070: " +
+	"Alias %s writes to %s, which looks like a rollover index, but no lifecycle policy rolls it " +
+	"over. Its shards keep growing, and get slower to recover and relocate. Attach a policy rolling " +
+	"it over, or roll it over by hand with POST %s/_rollover"
+
+// from how many indices per alias we advise about it
+// TODO make it configurable
+const maxIndicesPerAlias = 100
+
+// rollover generation suffix of index names, eg logs-000001
+var rolloverGeneration = regexp.MustCompile(`-\d{6}$`)
+
+// Indices of an alias, along with its write index
+type aliasIndices struct {
+	indices []string
+	// explicit write index, or the only index of the alias
+	writeIndex string
+}
+
+// Aliases of all the indices, by name
+func (d *Diagnostics) aliases() map[string]*aliasIndices {
+	result := map[string]*aliasIndices{}
+	for _, indexName := range d.sortedIndexNames() {
+		for name, alias := range d.Indices[indexName].Metadata.Aliases {
+			entry, ok := result[name]
+			if !ok {
+				entry = &aliasIndices{}
+				result[name] = entry
+			}
+			entry.indices = append(entry.indices, indexName)
+			if alias.IsWriteIndex != nil && *alias.IsWriteIndex {
+				entry.writeIndex = indexName
+			}
+		}
+	}
+	for _, entry := range result {
+		if len(entry.indices) == 1 && entry.writeIndex == "" {
+			entry.writeIndex = entry.indices[0]
+		}
+	}
+	return result
+}
+
+// Index setting expected to be the same across related indices
+type familySetting struct {
+	name      string
+	value     func(settings *metadata.IndexSettings) string
+	lifecycle bool // changed by lifecycle policies
+}
+
+// settings compared across the backing indices of data streams and the indices of each family.
+// Lifecycle policies change the number of shards and replicas of older indices, so only the indices
+// in the hot phase are compared
+var familySettings = []familySetting{
+	{"index.number_of_shards", func(s *metadata.IndexSettings) string { return s.NumberOfShards }, true},
+	{"index.number_of_replicas", func(s *metadata.IndexSettings) string { return s.NumberOfReplicas }, true},
+	{"index.refresh_interval", func(s *metadata.IndexSettings) string { return s.RefreshInterval }, false},
+	{"index.codec", func(s *metadata.IndexSettings) string { return s.Codec }, false},
+	{"index.default_pipeline", func(s *metadata.IndexSettings) string { return s.DefaultPipeline }, false},
+	{"index.final_pipeline", func(s *metadata.IndexSettings) string { return s.FinalPipeline }, false},
+	{"index.mapping.total_fields.limit", func(s *metadata.IndexSettings) string { return s.Mapping.TotalFields.Limit }, false},
+	{"index.mapping.depth.limit", func(s *metadata.IndexSettings) string { return s.Mapping.Depth.Limit }, false},
+	{"index.mapping.nested_fields.limit", func(s *metadata.IndexSettings) string { return s.Mapping.NestedFields.Limit }, false},
+}
+
+// Value of the setting for the index, "unset" when not set. False when the index is out of the
+// comparison
+func (s *familySetting) indexValue(index *Index) (string, bool) {
+	if s.lifecycle && index.Lifecycle != nil && index.Lifecycle.Phase != "hot" {
+		return "", false
+	}
+	value := s.value(&index.Metadata.Settings.Index)
+	if value == "" {
+		value = "unset"
+	}
+	return value, true
+}
+
+func (d *Diagnostics) processAliases(ctx context.Context) error {
+	aliases := d.aliases()
+	names := []string{}
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// rollover aliases as configured in the settings of the indices
+	rolloverAliases := map[string]struct{}{}
+	for _, index := range d.Indices {
+		if alias := rolloverAlias(index); alias != "" {
+			rolloverAliases[alias] = struct{}{}
+		}
+	}
+
+	for _, name := range names {
+		alias := aliases[name]
+		writeIndex := "without a write index"
+		if alias.writeIndex != "" {
+			writeIndex = fmt.Sprintf("writing to %s", alias.writeIndex)
+		}
+		d.Comment(I067_Alias, name, len(alias.indices), strings.Join(alias.indices, ", "), writeIndex)
+
+		_, isRolloverAlias := rolloverAliases[name]
+		if alias.writeIndex == "" {
+			if isRolloverAlias {
+				d.Comment(
+					W067_RolloverAliasWithoutWriteIndex, name, len(alias.indices), alias.indices[len(alias.indices)-1],
+					name,
+				)
+			} else {
+				d.Comment(A067_AliasWithoutWriteIndex, name, len(alias.indices))
+			}
+		}
+
+		if len(alias.indices) >= maxIndicesPerAlias {
+			shards := 0
+			for _, indexName := range alias.indices {
+				shards += len(d.Indices[indexName].Shards)
+			}
+			d.Comment(A068_AliasSpansManyIndices, name, len(alias.indices), shards)
+		}
+
+		// only known when lifecycle data is available
+		if alias.writeIndex == "" || d.Cluster == nil || d.Cluster.Lifecycle == nil {
+			continue
+		}
+		index := d.Indices[alias.writeIndex]
+		if !isRolloverAlias && !rolloverGeneration.MatchString(alias.writeIndex) {
+			continue
+		}
+		if index.Lifecycle != nil {
+			if policy, ok := d.Cluster.Lifecycle.Policies[index.Lifecycle.Policy]; !ok || policy.RollsOver {
+				continue
+			}
+		}
+		d.Comment(W070_OrphanedRolloverAlias, name, alias.writeIndex, name)
+	}
+
+	dataStreams := map[string]metadata.DataStream{}
+	if d.Cluster != nil && d.Cluster.State != nil {
+		dataStreams = d.Cluster.State.Metadata.DataStream.DataStreams
+	}
+	streamNames := []string{}
+	backingIndices := 0
+	for name, stream := range dataStreams {
+		streamNames = append(streamNames, name)
+		backingIndices += len(stream.Indices)
+	}
+	sort.Strings(streamNames)
+	for _, name := range streamNames {
+		stream := dataStreams[name]
+		if len(stream.Indices) == 0 {
+			continue
+		}
+		d.Comment(
+			I068_DataStream, name, len(stream.Indices), stream.Generation,
+			stream.Indices[len(stream.Indices)-1].IndexName,
+		)
+		for _, setting := range familySettings {
+			values := map[string]int{}
+			for _, backing := range stream.Indices {
+				index, ok := d.Indices[backing.IndexName]
+				if !ok {
+					continue
+				}
+				if value, ok := setting.indexValue(index); ok {
+					values[value]++
+				}
+			}
+			if len(values) > 1 {
+				d.Comment(W069_DataStreamInconsistentSettings, name, setting.name, topCounts(values, len(values)))
+			}
+		}
+	}
+
+	if len(aliases) > 0 || len(dataStreams) > 0 {
+		d.Comment(S067_AliasesAndDataStreams, len(aliases), len(dataStreams), backingIndices)
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package diagnosis
+
+import (
+	"context"
+	"testing"
+
+	"esdoctor/metadata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessAliases(t *testing.T) {
+	d := Diagnostics{
+		Cluster: &Cluster{
+			State:     &metadata.ClusterState{},
+			Lifecycle: &metadata.Lifecycle{Policies: map[string]*metadata.LifecyclePolicy{}},
+		},
+		Indices: map[string]*Index{},
+	}
+	isWriteIndex := true
+	addIndex := func(name string, rolloverAlias string, aliases ...string) *Index {
+		index := Index{Name: name, Metadata: &metadata.Index{Aliases: map[string]metadata.Alias{}}}
+		index.Metadata.Settings.Index.Lifecycle.RolloverAlias = rolloverAlias
+		for _, alias := range aliases {
+			index.Metadata.Aliases[alias] = metadata.Alias{}
+		}
+		d.Indices[name] = &index
+		return &index
+	}
+	addIndex("logs-000001", "logs", "logs", "all")
+	addIndex("logs-000002", "logs", "logs", "all")
+	addIndex("metrics-000001", "", "all")
+	addIndex("metrics-000002", "", "all", "metrics").Metadata.Aliases["metrics"] = metadata.Alias{IsWriteIndex: &isWriteIndex}
+	addIndex("products", "", "catalog")
+
+	addIndex(".ds-events-000001", "").Metadata.Settings.Index.NumberOfShards = "1"
+	addIndex(".ds-events-000002", "").Metadata.Settings.Index.NumberOfShards = "2"
+	d.Cluster.State.Metadata.DataStream.DataStreams = map[string]metadata.DataStream{"events": {
+		Name:       "events",
+		Generation: 2,
+		Indices:    []metadata.DataStreamIndex{{IndexName: ".ds-events-000001"}, {IndexName: ".ds-events-000002"}},
+	}}
+
+	assert.NoError(t, d.processAliases(context.Background()))
+	codes := commentsByCode(&d)
+	assert.Len(t, codes["I067"], 4)
+	assert.Equal(t, []string{"4 aliases and 1 data streams, with 2 backing indices"}, codes["S067"])
+	assert.Len(t, codes["W067"], 1)
+	assert.Contains(t, codes["W067"][0], "Rollover alias logs points to 2 indices")
+	assert.Len(t, codes["A067"], 1)
+	assert.Contains(t, codes["A067"][0], "Alias all points to 4 indices")
+	assert.Len(t, codes["W070"], 1)
+	assert.Contains(t, codes["W070"][0], "Alias metrics writes to metrics-000002")
+	assert.Equal(t, []string{
+		"Backing indices of data stream events have different index.number_of_shards: 1 (1), 2 (1). They " +
+			"are meant to be created from the same template. Check whether the template changed, or the " +
+			"settings were updated on some of them",
+	}, codes["W069"])
+	assert.Len(t, codes["I068"], 1)
+}
@@ -0,0 +1,189 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const I007_ShardAllocationExplanation = "I007: " +
+	"%s shard %s of %s is in %s state (unassigned reason: %s, failed allocation attempts: %d). " +
+	"Allocation decision: %s. Explanation: %s"
+
+const W007_ShardAllocationBlocked = "W007: " +
+	"%d shard copies cannot be allocated due to the %q allocation decider, which said no on %d nodes. " +
+	"Affected shards: %s. Example explanation: %q. Remediation: %s"
+
+const W008_ShardAllocationUndecided = "W008: " +
+	"%d shard copies cannot be allocated with decision %q. Affected shards: %s. " +
+	"Example explanation: %q. Remediation: %s"
+
+const S007_ShardAllocationDeciders = "S007: " +
+	"%d shard copies not in STARTED state were explained by the allocation explain api. " +
+	"Allocation is blocked by the following deciders: %s"
+
+// Remediations for the allocation deciders that most commonly prevent shards from being
+// allocated. Decider names are the ones returned by the _cluster/allocation/explain api
+var allocationDeciderRemediations = map[string]string{
+	"disk_threshold": "free up disk space in the data nodes (eg deleting old indices), add more data nodes " +
+		"or, carefully, raise the cluster.routing.allocation.disk.watermark.low and " +
+		"cluster.routing.allocation.disk.watermark.high cluster settings",
+	"same_shard": "a node cannot hold more than one copy of the same shard. Either add more data nodes or " +
+		"reduce the number of replicas with PUT <index>/_settings {\"index.number_of_replicas\": <n>}",
+	"awareness": "shard copies must be spread across the values of the attributes in " +
+		"cluster.routing.allocation.awareness.attributes. Add data nodes to the zones missing capacity " +
+		"or reduce the number of replicas so it fits the number of zones",
+	"filter": "the index or cluster allocation filters exclude the eligible nodes. Review the " +
+		"index.routing.allocation.include/exclude/require.* index settings with GET <index>/_settings " +
+		"and the cluster.routing.allocation.include/exclude/require.* cluster settings with " +
+		"GET _cluster/settings, then remove stale filters (eg from decommissioned nodes)",
+	"max_retry": "allocation failed too many times and will not be retried automatically. Fix the " +
+		"underlying failure shown in the explanation and then retry with " +
+		"POST _cluster/reroute?retry_failed=true",
+	"shards_limit": "the index.routing.allocation.total_shards_per_node or " +
+		"cluster.routing.allocation.total_shards_per_node limit is reached. Raise the limit or add more data nodes",
+	"enable": "shard allocation is disabled. Re-enable it with PUT _cluster/settings " +
+		"{\"persistent\": {\"cluster.routing.allocation.enable\": null}} and check the " +
+		"index.routing.allocation.enable index setting",
+	"node_version": "shards cannot be allocated from newer to older nodes. Finish the rolling upgrade " +
+		"of the remaining nodes",
+	"data_tier": "no node in the preferred data tier (index.routing.allocation.include._tier_preference) " +
+		"is available. Add nodes with the required data tier role or change the tier preference",
+}
+
+// Remediations for allocation decisions that are not caused by a specific decider
+var allocationDecisionRemediations = map[string]string{
+	"no_valid_shard_copy": "no node holds a valid copy of this primary shard. Bring back the nodes that held " +
+		"the data, restore the index from a snapshot or, as a last resort and accepting data loss, use the " +
+		"allocate_stale_primary or allocate_empty_primary commands of the _cluster/reroute api",
+	"allocation_delayed": "allocation is delayed waiting for the node that left the cluster to come back. " +
+		"Check the index.unassigned.node_left.delayed_timeout index setting",
+	"throttled": "allocation is throttled by the concurrent recoveries limits and should eventually proceed. " +
+		"Check ongoing recoveries with GET _cat/recovery?active_only=true",
+	"awaiting_info": "the master is still fetching shard information from the nodes. Wait and check again",
+}
+
+const defaultAllocationRemediation = "check the full explanation with GET _cluster/allocation/explain"
+
+func (d *Diagnostics) processAllocationExplanations(ctx context.Context) error {
+	type group struct {
+		shards      []string
+		nodes       map[string]struct{}
+		explanation string
+	}
+	deciderGroups := map[string]*group{}
+	decisionGroups := map[string]*group{}
+	explained := 0
+
+	for _, shard := range d.Shards {
+		explanation := shard.Allocation
+		if explanation == nil {
+			continue
+		}
+		explained++
+		shardType := "primary"
+		if !shard.State.Primary {
+			shardType = "replica"
+		}
+		decision := explanation.CanAllocate
+		if decision == "" {
+			decision = explanation.CanMoveToOtherNode
+		}
+		summary := explanation.AllocateExplanation
+		if summary == "" {
+			summary = explanation.MoveExplanation
+		}
+		d.Comment(
+			I007_ShardAllocationExplanation, shardType, shard.ID, shard.IndexName, shard.State.State,
+			explanation.UnassignedInfo.Reason, explanation.UnassignedInfo.FailedAllocationAttempts,
+			decision, summary,
+		)
+
+		shardLabel := fmt.Sprintf("%s[%s][%s]", shard.IndexName, shard.ID, shardType[0:1])
+		blocked := false
+		for _, node := range explanation.NodeAllocationDecisions {
+			if node.NodeDecision != "no" {
+				continue
+			}
+			for _, decider := range node.Deciders {
+				if decider.Decision != "NO" {
+					continue
+				}
+				blocked = true
+				g, ok := deciderGroups[decider.Decider]
+				if !ok {
+					g = &group{nodes: map[string]struct{}{}, explanation: decider.Explanation}
+					deciderGroups[decider.Decider] = g
+				}
+				if len(g.shards) == 0 || g.shards[len(g.shards)-1] != shardLabel {
+					g.shards = append(g.shards, shardLabel)
+				}
+				g.nodes[node.NodeID] = struct{}{}
+			}
+		}
+
+		// shards that are not blocked by any decider in particular (eg a primary without any valid copy)
+		if !blocked && decision != "" && decision != "yes" {
+			g, ok := decisionGroups[decision]
+			if !ok {
+				g = &group{explanation: summary}
+				decisionGroups[decision] = g
+			}
+			g.shards = append(g.shards, shardLabel)
+		}
+	}
+
+	if explained == 0 {
+		return nil
+	}
+
+	deciders := []string{}
+	for decider := range deciderGroups {
+		deciders = append(deciders, decider)
+	}
+	// reverse sort from most to least shards affected
+	sort.Slice(deciders, func(i int, j int) bool {
+		return len(deciderGroups[deciders[i]].shards) > len(deciderGroups[deciders[j]].shards)
+	})
+	summary := []string{}
+	for _, decider := range deciders {
+		g := deciderGroups[decider]
+		remediation, ok := allocationDeciderRemediations[decider]
+		if !ok {
+			remediation = defaultAllocationRemediation
+		}
+		d.Comment(
+			W007_ShardAllocationBlocked, len(g.shards), decider, len(g.nodes),
+			strings.Join(g.shards, ", "), g.explanation, remediation,
+		)
+		summary = append(summary, fmt.Sprintf("%s (%d shard copies)", decider, len(g.shards)))
+	}
+
+	decisions := []string{}
+	for decision := range decisionGroups {
+		decisions = append(decisions, decision)
+	}
+	sort.Slice(decisions, func(i int, j int) bool {
+		return len(decisionGroups[decisions[i]].shards) > len(decisionGroups[decisions[j]].shards)
+	})
+	for _, decision := range decisions {
+		g := decisionGroups[decision]
+		remediation, ok := allocationDecisionRemediations[decision]
+		if !ok {
+			remediation = defaultAllocationRemediation
+		}
+		d.Comment(
+			W008_ShardAllocationUndecided, len(g.shards), decision, strings.Join(g.shards, ", "),
+			g.explanation, remediation,
+		)
+		summary = append(summary, fmt.Sprintf("%s (%d shard copies)", decision, len(g.shards)))
+	}
+
+	if len(summary) == 0 {
+		summary = append(summary, "none")
+	}
+	d.Comment(S007_ShardAllocationDeciders, explained, strings.Join(summary, ", "))
+
+	return nil
+}
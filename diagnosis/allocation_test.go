@@ -0,0 +1,63 @@
+package diagnosis
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"esdoctor/metadata"
+	"esdoctor/stats"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessAllocationExplanations(t *testing.T) {
+	// logs[0] has a started replica and an unassigned one, which the explain api describes
+	state := metadata.ClusterState{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"routing_table": {"indices": {"logs": {"shards": {"0": [
+		{"state": "STARTED", "primary": true, "node": "n1", "shard": 0, "index": "logs"},
+		{"state": "STARTED", "primary": false, "node": "n2", "shard": 0, "index": "logs"},
+		{"state": "UNASSIGNED", "primary": false, "shard": 0, "index": "logs"}
+	]}}}}}`), &state))
+	explanation := metadata.AllocationExplanation{
+		Index:       "logs",
+		CanAllocate: "no",
+		NodeAllocationDecisions: []metadata.NodeAllocationDecision{
+			{NodeID: "n1", NodeDecision: "no", Deciders: []metadata.AllocationDeciderOutcome{
+				{Decider: "same_shard", Decision: "NO", Explanation: "a copy of this shard is already allocated to this node"},
+			}},
+			{NodeID: "n2", NodeDecision: "no", Deciders: []metadata.AllocationDeciderOutcome{
+				{Decider: "same_shard", Decision: "NO", Explanation: "a copy of this shard is already allocated to this node"},
+			}},
+		},
+	}
+	explanation.UnassignedInfo.Reason = "NODE_LEFT"
+
+	d := Diagnostics{}
+	d.normalize(dataCollection{
+		indicesMetadata: metadata.Indices{"logs": &metadata.Index{}},
+		clusterState:    &state,
+		nodesInfo:       &metadata.NodesInfo{},
+		nodesStats: &stats.Nodes{Nodes: map[string]*stats.Node{
+			"n1": {Name: "node-1", Roles: []string{"data"}},
+			"n2": {Name: "node-2", Roles: []string{"data"}},
+		}},
+		indicesStats: &stats.Indices{},
+		tasks:        &stats.Tasks{},
+		allocationExplanations: map[shardCopyKey]*metadata.AllocationExplanation{
+			{index: "logs", shard: 0, primary: false}: &explanation,
+		},
+	})
+	assert.NoError(t, d.processAllocationExplanations(context.Background()))
+	codes := commentsByCode(&d)
+	assert.Equal(t, []string{
+		"replica shard 0 of logs is in UNASSIGNED state (unassigned reason: NODE_LEFT, failed allocation " +
+			"attempts: 0). Allocation decision: no. Explanation: ",
+	}, codes["I007"])
+	assert.Len(t, codes["W007"], 1)
+	assert.Contains(t, codes["W007"][0], "1 shard copies cannot be allocated due to the \"same_shard\" allocation decider, which said no on 2 nodes. Affected shards: logs[0][r]")
+	assert.Equal(t, []string{
+		"1 shard copies not in STARTED state were explained by the allocation explain api. Allocation is " +
+			"blocked by the following deciders: same_shard (1 shard copies)",
+	}, codes["S007"])
+}
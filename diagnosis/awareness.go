@@ -0,0 +1,202 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const S037_ZoneDistribution = "S037: " +
+	"Data nodes per %s (allocation awareness %s): %s"
+
+const A037_AwarenessNotConfigured = "A037: " +
+	"Data nodes carry the %s attribute with %d values, but it is not used for allocation awareness, " +
+	"so all copies of a shard may be allocated in the same %s. Enable it with PUT _cluster/settings " +
+	"{\"persistent\": {\"cluster.routing.allocation.awareness.attributes\": %q}}"
+
+const W037_UnbalancedZones = "W037: " +
+	"Data nodes are unevenly spread across %s values: %s. Allocation awareness spreads shard copies " +
+	"evenly across zones, so the nodes of the smaller zones hold more shards and data than the others, " +
+	"and losing a larger zone takes more capacity away. Use the same number of data nodes per %s"
+
+const W038_NodesMissingAwarenessAttribute = "W038: " +
+	"Data nodes %s have no %s attribute, while it is used for allocation awareness. Shards cannot " +
+	"be allocated to nodes missing an awareness attribute. Set node.attr.%s in their configuration"
+
+const W039_ShardCopiesInSameZone = "W039: " +
+	"Index %s has all the copies of %d shard(s) in the same %s: %s. All the copies of these shards " +
+	"are lost if that %s goes down. Check the allocation awareness settings and the capacity of the " +
+	"other zones with GET _cluster/allocation/explain"
+
+const W040_NoReplicasZoneLoss = "W040: " +
+	"%d indices have no replicas, so they lose shards if any %s holding them goes down: %s. Add " +
+	"replicas with PUT <index>/_settings {\"index.number_of_replicas\": 1} so copies are allocated " +
+	"in different zones"
+
+// node attributes commonly used for zones, checked when no awareness attribute is configured
+var zoneAttributes = []string{"zone", "availability_zone", "aws_availability_zone", "az", "rack", "rack_id"}
+
+// from which ratio between the zones with the most and least data nodes we warn about it
+// TODO make it configurable
+const unbalancedZonesRatio float64 = 1.5
+
+// Zone of a node as given by the passed attribute. Empty for unknown
+func nodeZone(node *Node, attribute string) string {
+	if node == nil || node.Info == nil {
+		return ""
+	}
+	return node.Info.Attributes[attribute]
+}
+
+// Data nodes grouped by their zone as given by the passed attribute. Nodes without it are grouped
+// under the empty zone
+func (d *Diagnostics) nodesByZone(attribute string) map[string][]string {
+	result := map[string][]string{}
+	for _, node := range sortedNodes(d.Nodes.Data) {
+		zone := nodeZone(node, attribute)
+		result[zone] = append(result[zone], node.Name)
+	}
+	return result
+}
+
+func (d *Diagnostics) awarenessAttributes() []string {
+	if d.Cluster == nil || d.Cluster.Settings == nil {
+		return nil
+	}
+	result := []string{}
+	for _, attribute := range strings.Split(d.Cluster.Settings.Get("cluster.routing.allocation.awareness.attributes"), ",") {
+		if attribute = strings.TrimSpace(attribute); attribute != "" {
+			result = append(result, attribute)
+		}
+	}
+	return result
+}
+
+func (d *Diagnostics) processAwareness(ctx context.Context) error {
+	attributes := d.awarenessAttributes()
+	configured := len(attributes) > 0
+	if !configured {
+		for _, attribute := range zoneAttributes {
+			zones := d.nodesByZone(attribute)
+			delete(zones, "")
+			if len(zones) > 1 {
+				d.Comment(A037_AwarenessNotConfigured, attribute, len(zones), attribute, attribute)
+				attributes = append(attributes, attribute)
+				break
+			}
+		}
+	}
+
+	for _, attribute := range attributes {
+		zones := d.nodesByZone(attribute)
+		if missing, ok := zones[""]; ok {
+			if configured {
+				d.Comment(W038_NodesMissingAwarenessAttribute, strings.Join(missing, ", "), attribute, attribute)
+			}
+			delete(zones, "")
+		}
+		if len(zones) == 0 {
+			continue
+		}
+
+		awareness := "disabled"
+		if configured {
+			awareness = "enabled"
+			if forced := d.Cluster.Settings.Get("cluster.routing.allocation.awareness.force." + attribute + ".values"); forced != "" {
+				awareness = fmt.Sprintf("enabled, forced to %s", forced)
+			}
+		}
+		counts := map[string]int{}
+		minNodes, maxNodes := -1, 0
+		for zone, names := range zones {
+			counts[zone] = len(names)
+			if minNodes == -1 || len(names) < minNodes {
+				minNodes = len(names)
+			}
+			if len(names) > maxNodes {
+				maxNodes = len(names)
+			}
+		}
+		d.Comment(S037_ZoneDistribution, attribute, awareness, topCounts(counts, len(counts)))
+		if len(zones) < 2 {
+			continue
+		}
+		if float64(maxNodes) >= float64(minNodes)*unbalancedZonesRatio {
+			d.Comment(W037_UnbalancedZones, attribute, topCounts(counts, len(counts)), attribute)
+		}
+
+		d.checkZoneLoss(attribute)
+	}
+
+	return nil
+}
+
+// max number of indices listed in W040
+const zoneLossIndicesToShow = 10
+
+// Looks for shards whose assigned copies are all in the same zone. Indices without replicas are
+// already reported one by one in W003, so they are summarized in a single comment
+func (d *Diagnostics) checkZoneLoss(attribute string) {
+	noReplicasLoss := []string{}
+	for _, indexName := range d.sortedIndexNames() {
+		index := d.Indices[indexName]
+		noReplicas := settingInt(index.Metadata.Settings.Index.NumberOfReplicas, 1) == 0
+		shardZones := map[string]map[string]struct{}{}
+		shardCopies := map[string]int{}
+		for _, shard := range index.Shards {
+			if shard.Node == nil {
+				continue
+			}
+			shardCopies[shard.ID]++
+			if _, ok := shardZones[shard.ID]; !ok {
+				shardZones[shard.ID] = map[string]struct{}{}
+			}
+			shardZones[shard.ID][nodeZone(shard.Node, attribute)] = struct{}{}
+		}
+
+		shardIDs := []string{}
+		for id := range shardZones {
+			shardIDs = append(shardIDs, id)
+		}
+		sort.Slice(shardIDs, func(i int, j int) bool {
+			return settingInt(shardIDs[i], 0) < settingInt(shardIDs[j], 0)
+		})
+		lost := []string{}
+		lostZones := map[string]struct{}{}
+		for _, id := range shardIDs {
+			// shards with unassigned replicas are reported by the allocation rules
+			if len(shardZones[id]) != 1 || (!noReplicas && shardCopies[id] < 2) {
+				continue
+			}
+			for zone := range shardZones[id] {
+				if zone == "" {
+					zone = "unknown"
+				}
+				lost = append(lost, fmt.Sprintf("shard %s in %s", id, zone))
+				lostZones[zone] = struct{}{}
+			}
+		}
+		if len(lost) == 0 {
+			continue
+		}
+		if noReplicas {
+			zones := []string{}
+			for zone := range lostZones {
+				zones = append(zones, zone)
+			}
+			sort.Strings(zones)
+			noReplicasLoss = append(noReplicasLoss, fmt.Sprintf("%s (%s)", indexName, strings.Join(zones, ", ")))
+		} else {
+			d.Comment(W039_ShardCopiesInSameZone, indexName, len(lost), attribute, strings.Join(lost, ", "), attribute)
+		}
+	}
+
+	if len(noReplicasLoss) > 0 {
+		count := len(noReplicasLoss)
+		if count > zoneLossIndicesToShow {
+			noReplicasLoss = append(noReplicasLoss[:zoneLossIndicesToShow], "...")
+		}
+		d.Comment(W040_NoReplicasZoneLoss, count, attribute, strings.Join(noReplicasLoss, ", "))
+	}
+}
@@ -0,0 +1,50 @@
+package diagnosis
+
+import (
+	"context"
+	"testing"
+
+	"esdoctor/metadata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessAwarenessZoneLoss(t *testing.T) {
+	d := Diagnostics{Nodes: Nodes{Data: map[string]*Node{}}, Indices: map[string]*Index{}}
+	for name, zone := range map[string]string{"node-a": "a", "node-b": "b"} {
+		d.Nodes.Data[name] = &Node{ID: name, Name: name, Info: &metadata.NodeInfo{Attributes: map[string]string{"zone": zone}}}
+	}
+	addShard := func(index *Index, id string, primary bool, node string) {
+		index.Shards = append(index.Shards, &Shard{
+			ID:    id,
+			State: &metadata.ShardState{Primary: primary},
+			Node:  d.Nodes.Data[node],
+		})
+	}
+	addIndex := func(name string, replicas string) *Index {
+		index := Index{Name: name, Metadata: &metadata.Index{}}
+		index.Metadata.Settings.Index.NumberOfReplicas = replicas
+		d.Indices[name] = &index
+		return &index
+	}
+	logs := addIndex("logs", "0")
+	addShard(logs, "0", true, "node-a")
+	addShard(logs, "1", true, "node-b")
+	metrics := addIndex("metrics", "0")
+	addShard(metrics, "0", true, "node-a")
+	events := addIndex("events", "1")
+	addShard(events, "0", true, "node-b")
+	addShard(events, "0", false, "node-b")
+
+	assert.NoError(t, d.processAwareness(context.Background()))
+	codes := commentsByCode(&d)
+	assert.Len(t, codes["A037"], 1)
+	// indices without replicas get a single comment, as each already gets W003
+	assert.Equal(t, []string{
+		"2 indices have no replicas, so they lose shards if any zone holding them goes down: logs (a, b), " +
+			"metrics (a). Add replicas with PUT <index>/_settings {\"index.number_of_replicas\": 1} so copies " +
+			"are allocated in different zones",
+	}, codes["W040"])
+	assert.Len(t, codes["W039"], 1)
+	assert.Contains(t, codes["W039"][0], "Index events has all the copies of 1 shard(s) in the same zone: shard 0 in b")
+}
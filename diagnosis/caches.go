@@ -0,0 +1,205 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"esdoctor/math"
+	"esdoctor/stats"
+	"esdoctor/util"
+)
+
+const I026_NodeCaches = "I026: " +
+	"Node %s has a query cache of %s (hit ratio of %.1f%% over %d lookups, %d evictions), a request " +
+	"cache of %s (hit ratio of %.1f%% over %d lookups, %d evictions) and %s of fielddata (%.1f%% of " +
+	"the heap, %d evictions)%s"
+
+const I027_IndexCaches = "I027: " +
+	"Index %s has a query cache of %s (hit ratio of %.1f%% over %d lookups, %d evictions), a request " +
+	"cache of %s (hit ratio of %.1f%% over %d lookups, %d evictions) and %s of fielddata (%d " +
+	"evictions)%s"
+
+const S026_ClusterCaches = "S026: " +
+	"Across all nodes, the query cache uses %s with a hit ratio of %.1f%%, the request cache uses %s " +
+	"with a hit ratio of %.1f%% and fielddata uses %s"
+
+const W026_FielddataEvictions = "W026: " +
+	"Node %s is evicting fielddata (%s). Fielddata is expensive to build, so evicting it means it is " +
+	"loaded over and over, taking heap and cpu. Find which fields use it with GET _cat/fielddata?v " +
+	"and prefer sorting and aggregating on fields with doc values, such as keyword fields"
+
+const W027_TextFielddata = "W027: " +
+	"Index %s enables fielddata on the text fields %s, and holds %s of fielddata in memory. " +
+	"Fielddata on text fields loads every analyzed term into the heap, and is a common cause of heap " +
+	"pressure and circuit breaker errors. Sort, aggregate and script on a keyword multi-field instead"
+
+const A026_LowRequestCacheHitRatio = "A026: " +
+	"Index %s request cache has a hit ratio of %.1f%% over %d lookups. Only size=0 searches are " +
+	"cached by default, searches using now in date ranges are not cacheable, and the cache is " +
+	"invalidated on every refresh that changes the shard. Consider rounding dates in queries (eg " +
+	"now/m) and using longer refresh intervals, or not caching these requests at all"
+
+const A027_QueryCacheThrashing = "A027: " +
+	"Node %s query cache evicted %d of the %d entries ever cached (%.1f%%) and has a hit ratio of " +
+	"%.1f%%. Entries are evicted before being reused, so the cache costs more than it saves. If " +
+	"there is heap headroom, consider raising indices.queries.cache.size"
+
+const A028_RequestCacheDisabled = "A028: " +
+	"Index %s has the request cache disabled, but is read mostly (%d queries against %d indexing " +
+	"operations since nodes started). The request cache serves repeated size=0 searches (eg " +
+	"dashboard aggregations) without searching the shards again. Enable it with PUT %s/_settings " +
+	"{\"index.requests.cache.enable\": true}"
+
+// min number of lookups of a cache to look into its hit ratio
+const cacheMinLookups = 10000
+
+// below which hit ratio (pct) the request cache is considered ineffective
+// TODO make it configurable
+const lowRequestCacheHitRatio float64 = 10
+
+// from which share of evicted entries (pct) and below which hit ratio (pct) the query cache is
+// considered to be thrashing
+const queryCacheThrashingEvictions float64 = 50
+const queryCacheThrashingHitRatio float64 = 20
+
+// how many times more queries than indexing operations an index needs to be read mostly
+const readMostlyFactor = 10
+
+// Hit ratio in pct and the number of lookups of a cache
+func hitRatio(hits int, misses int) (float64, int) {
+	lookups := hits + misses
+	if lookups == 0 {
+		return 0, 0
+	}
+	return math.Pct(hits, lookups), lookups
+}
+
+func formatCacheEvictionRates(interval time.Duration, rates stats.CacheEvictionsPerSecond) string {
+	return fmt.Sprintf(
+		". Over the last %v it evicted %.1f query cache, %.1f request cache and %.1f fielddata "+
+			"entries per second", interval, rates.QueryCacheEvictionsPerSecond,
+		rates.RequestCacheEvictionsPerSecond, rates.FielddataEvictionsPerSecond,
+	)
+}
+
+func (d *Diagnostics) processCaches(ctx context.Context) error {
+	var queryCacheBytes, requestCacheBytes, fielddataBytes int64
+	var queryCacheHits, queryCacheMisses, requestCacheHits, requestCacheMisses int
+
+	for _, node := range sortedNodes(d.Nodes.All) {
+		l := node.Stats.Indices
+		queryCacheRatio, queryCacheLookups := hitRatio(l.QueryCache.HitCount, l.QueryCache.MissCount)
+		requestCacheRatio, requestCacheLookups := hitRatio(l.RequestCache.HitCount, l.RequestCache.MissCount)
+		heapPct := 0.0
+		if node.Stats.Jvm.Mem.HeapMaxInBytes > 0 {
+			heapPct = math.Pct64(int64(l.Fielddata.MemorySizeInBytes), node.Stats.Jvm.Mem.HeapMaxInBytes)
+		}
+		sampled := node.Rates != nil && !node.Rates.Restarted
+		rates := ""
+		if sampled {
+			rates = formatCacheEvictionRates(node.Rates.Interval, node.Rates.CacheEvictionsPerSecond)
+		}
+		d.Comment(
+			I026_NodeCaches, node.Name,
+			util.HumanizeBytes(int64(l.QueryCache.MemorySizeInBytes)), queryCacheRatio, queryCacheLookups,
+			l.QueryCache.Evictions,
+			util.HumanizeBytes(int64(l.RequestCache.MemorySizeInBytes)), requestCacheRatio, requestCacheLookups,
+			l.RequestCache.Evictions,
+			util.HumanizeBytes(int64(l.Fielddata.MemorySizeInBytes)), heapPct, l.Fielddata.Evictions, rates,
+		)
+
+		queryCacheBytes += int64(l.QueryCache.MemorySizeInBytes)
+		requestCacheBytes += int64(l.RequestCache.MemorySizeInBytes)
+		fielddataBytes += int64(l.Fielddata.MemorySizeInBytes)
+		queryCacheHits += l.QueryCache.HitCount
+		queryCacheMisses += l.QueryCache.MissCount
+		requestCacheHits += l.RequestCache.HitCount
+		requestCacheMisses += l.RequestCache.MissCount
+
+		// when sampling, only evictions happening right now are relevant
+		if sampled && node.Rates.FielddataEvictionsPerSecond > 0 {
+			d.Comment(W026_FielddataEvictions, node.Name, fmt.Sprintf(
+				"%.1f evictions per second over the last %v", node.Rates.FielddataEvictionsPerSecond,
+				node.Rates.Interval,
+			))
+		} else if !sampled && l.Fielddata.Evictions > 0 {
+			d.Comment(W026_FielddataEvictions, node.Name, fmt.Sprintf(
+				"%d evictions since it started", l.Fielddata.Evictions,
+			))
+		}
+
+		if l.QueryCache.CacheCount >= cacheMinLookups {
+			evictedPct := math.Pct(l.QueryCache.Evictions, l.QueryCache.CacheCount)
+			if evictedPct >= queryCacheThrashingEvictions && queryCacheRatio < queryCacheThrashingHitRatio {
+				d.Comment(
+					A027_QueryCacheThrashing, node.Name, l.QueryCache.Evictions, l.QueryCache.CacheCount,
+					evictedPct, queryCacheRatio,
+				)
+			}
+		}
+	}
+
+	if len(d.Nodes.All) > 0 {
+		queryCacheRatio, _ := hitRatio(queryCacheHits, queryCacheMisses)
+		requestCacheRatio, _ := hitRatio(requestCacheHits, requestCacheMisses)
+		d.Comment(
+			S026_ClusterCaches, util.HumanizeBytes(queryCacheBytes), queryCacheRatio,
+			util.HumanizeBytes(requestCacheBytes), requestCacheRatio, util.HumanizeBytes(fielddataBytes),
+		)
+	}
+
+	for _, indexName := range d.sortedIndexNames() {
+		index := d.Indices[indexName]
+		if index.Closed() {
+			continue
+		}
+
+		fielddataMemory := int64(0)
+		if index.Stats != nil {
+			fielddataMemory = int64(index.Stats.Total.Fielddata.MemorySizeInBytes)
+		}
+		if fields := index.Metadata.Mappings.FielddataFields(); len(fields) > 0 {
+			d.Comment(
+				W027_TextFielddata, indexName, strings.Join(fields, ", "), util.HumanizeBytes(fielddataMemory),
+			)
+		}
+
+		if index.Stats == nil {
+			continue
+		}
+		l := index.Stats.Total
+		queryCacheRatio, queryCacheLookups := hitRatio(l.QueryCache.HitCount, l.QueryCache.MissCount)
+		requestCacheRatio, requestCacheLookups := hitRatio(l.RequestCache.HitCount, l.RequestCache.MissCount)
+		rates := ""
+		if index.Rates != nil && !index.Rates.Reset {
+			rates = formatCacheEvictionRates(index.Rates.Interval, index.Rates.CacheEvictionsPerSecond)
+		}
+		d.Comment(
+			I027_IndexCaches, indexName,
+			util.HumanizeBytes(int64(l.QueryCache.MemorySizeInBytes)), queryCacheRatio, queryCacheLookups,
+			l.QueryCache.Evictions,
+			util.HumanizeBytes(int64(l.RequestCache.MemorySizeInBytes)), requestCacheRatio, requestCacheLookups,
+			l.RequestCache.Evictions,
+			util.HumanizeBytes(fielddataMemory), l.Fielddata.Evictions, rates,
+		)
+
+		// caching advice does not apply to indices searched throttled or managed by ES itself
+		if index.Frozen || index.Hidden {
+			continue
+		}
+		if requestCacheLookups >= cacheMinLookups && requestCacheRatio < lowRequestCacheHitRatio {
+			d.Comment(A026_LowRequestCacheHitRatio, indexName, requestCacheRatio, requestCacheLookups)
+		}
+
+		requestCacheEnabled := index.Metadata.Settings.Index.Requests.Cache.Enable
+		queries, indexingOps := l.Search.QueryTotal, l.Indexing.IndexTotal
+		readMostly := indexIsReadOnly(index) || indexingOps*readMostlyFactor <= queries
+		if strings.ToLower(requestCacheEnabled) == "false" && queries >= latencyMinOperations && readMostly {
+			d.Comment(A028_RequestCacheDisabled, indexName, queries, indexingOps, indexName)
+		}
+	}
+
+	return nil
+}
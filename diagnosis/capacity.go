@@ -0,0 +1,268 @@
+package diagnosis
+
+import (
+	"errors"
+	"fmt"
+	gomath "math"
+	"sort"
+	"strings"
+	"time"
+
+	"esdoctor/math"
+	"esdoctor/stats"
+	"esdoctor/util"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const I047_NodeGrowth = "I047: " +
+	"Node %s uses %s of disk, growing %s per day over %d samples, and %s"
+
+const I048_IndexGrowth = "I048: " +
+	"Index %s has %s of data (including replicas), growing %s per day over %d samples"
+
+const S047_DaysToFull = "S047: " +
+	"Days until each data node crosses the high disk watermark (%s): %s"
+
+const S048_TopGrowingIndices = "S048: " +
+	"Top %d indices by growth per day: %s"
+
+const S049_ClusterCapacity = "S049: " +
+	"Across %d samples over %.1f days, the data in the cluster grows %s per day. Data nodes have %s " +
+	"of disk headroom below the high disk watermark (%s), %s. Days to full across data nodes: min " +
+	"of %s, p50 of %s and max of %s"
+
+const W047_NodeFullWithinHorizon = "W047: " +
+	"Node %s crosses the high disk watermark in %.1f days (growing %s per day), within the planning " +
+	"horizon of %.0f days. Past the high watermark shards are relocated away from the node, and past " +
+	"the flood stage watermark its indices become read only"
+
+const A047_AdditionalDataNodes = "A047: " +
+	"To absorb the projected growth of %s over the next %.0f days, the cluster needs %s more than its " +
+	"current disk headroom: about %d additional data nodes of the current median disk size (%s, with " +
+	"%s below the high disk watermark)"
+
+// ES default, used in case the setting cannot be read
+const defaultDiskWatermarkHigh = "90%"
+
+// how many of the fastest growing indices are listed
+const topGrowingIndicesToShow = 10
+
+// Storage growth fitted over a series of samples
+type growth struct {
+	samples     int
+	current     int64   // bytes in the latest sample
+	bytesPerDay float64 // may be negative when shrinking
+}
+
+// Fits the storage growth over the given (collection time, bytes) samples
+func fitGrowth(times []time.Time, bytes []int64) (growth, bool) {
+	if len(times) < 2 {
+		return growth{}, false
+	}
+	xs, ys := []float64{}, []float64{}
+	for i := range times {
+		xs = append(xs, times[i].Sub(times[0]).Hours()/24)
+		ys = append(ys, float64(bytes[i]))
+	}
+	slope, _, ok := math.LinearFit(xs, ys)
+	if !ok {
+		return growth{}, false
+	}
+	return growth{samples: len(times), current: bytes[len(bytes)-1], bytesPerDay: slope}, true
+}
+
+func formatDays(days float64) string {
+	if gomath.IsInf(days, 1) {
+		return "never"
+	}
+	return fmt.Sprintf("%.1f days", days)
+}
+
+// Projects storage growth out of diagnostics collected over time (eg json dumps), emitting the
+// capacity planning comments on the latest of them, which is returned
+func PlanCapacity(history []*Diagnostics, options ...Option) (*Diagnostics, error) {
+	if len(history) < 2 {
+		return nil, errors.New("capacity planning needs at least two diagnostics samples")
+	}
+	for idx, d := range history {
+		if d.CollectedAt().IsZero() {
+			return nil, fmt.Errorf("cannot tell when diagnostics sample #%d was collected", idx+1)
+		}
+	}
+	history = append([]*Diagnostics{}, history...)
+	sort.SliceStable(history, func(i int, j int) bool {
+		return history[i].CollectedAt().Before(history[j].CollectedAt())
+	})
+
+	latest := history[len(history)-1]
+	latest.config = newConfig(options...)
+	latest.comments = nil
+
+	if latest.config.writer != nil {
+		if err := latest.config.writer.Begin(latest); err != nil {
+			return latest, err
+		}
+	}
+	if err := latest.processCapacity(history); err != nil {
+		return latest, err
+	}
+	if latest.config.writer != nil {
+		if err := latest.config.writer.End(latest); err != nil {
+			return latest, err
+		}
+	}
+	return latest, nil
+}
+
+func (d *Diagnostics) processCapacity(history []*Diagnostics) error {
+	horizonDays := d.config.planningHorizon.Hours() / 24
+	watermark := defaultDiskWatermarkHigh
+	if d.Cluster != nil && d.Cluster.Settings != nil {
+		if setting := d.Cluster.Settings.Get("cluster.routing.allocation.disk.watermark.high"); setting != "" {
+			watermark = setting
+		}
+	}
+
+	// nodes growth, only for the data nodes of the latest sample
+	daysToFull := map[string]float64{}
+	var totalHeadroom int64
+	var totalBytesPerDay float64
+	nodeSizes := []int64{}
+	for _, node := range sortedNodes(d.Nodes.Data) {
+		times, bytes := []time.Time{}, []int64{}
+		for _, sample := range history {
+			if sampled, ok := sample.Nodes.Data[node.ID]; ok && sampled.Stats != nil {
+				fs := sampled.Stats.Fs.Total
+				times = append(times, sample.CollectedAt())
+				bytes = append(bytes, fs.TotalInBytes-fs.AvailableInBytes)
+			}
+		}
+		headroom, err := nodeDiskHeadroom(node, watermark)
+		if err != nil {
+			return err
+		}
+		totalHeadroom += headroom
+		nodeSizes = append(nodeSizes, node.Stats.Fs.Total.TotalInBytes)
+
+		g, ok := fitGrowth(times, bytes)
+		if !ok {
+			log.Warnf("Not enough samples of node %s to fit its disk growth", node.Name)
+			continue
+		}
+		totalBytesPerDay += g.bytesPerDay
+		days := gomath.Inf(1)
+		projection := "is not growing"
+		if g.bytesPerDay > 0 {
+			days = float64(headroom) / g.bytesPerDay
+			projection = fmt.Sprintf("crosses the high disk watermark (%s) in %s", watermark, formatDays(days))
+		}
+		daysToFull[node.Name] = days
+		d.Comment(
+			I047_NodeGrowth, node.Name, util.HumanizeBytes(g.current), util.HumanizeBytesF(g.bytesPerDay),
+			g.samples, projection,
+		)
+		if days <= horizonDays {
+			d.Comment(W047_NodeFullWithinHorizon, node.Name, days, util.HumanizeBytesF(g.bytesPerDay), horizonDays)
+		}
+	}
+
+	if len(daysToFull) > 0 {
+		names := []string{}
+		allDays := []float64{}
+		for name, days := range daysToFull {
+			names = append(names, name)
+			allDays = append(allDays, days)
+		}
+		sort.Slice(names, func(i int, j int) bool {
+			if daysToFull[names[i]] != daysToFull[names[j]] {
+				return daysToFull[names[i]] < daysToFull[names[j]]
+			}
+			return names[i] < names[j]
+		})
+		table := []string{}
+		for _, name := range names {
+			table = append(table, fmt.Sprintf("%s: %s", name, formatDays(daysToFull[name])))
+		}
+		d.Comment(S047_DaysToFull, watermark, strings.Join(table, ", "))
+
+		span := history[len(history)-1].CollectedAt().Sub(history[0].CollectedAt()).Hours() / 24
+		clusterProjection := "which is enough as the data is not growing"
+		if totalBytesPerDay > 0 {
+			clusterProjection = fmt.Sprintf(
+				"enough for %s at the current growth", formatDays(float64(totalHeadroom)/totalBytesPerDay),
+			)
+		}
+		pct := math.PercentilesFloat64(allDays, 10)
+		d.Comment(
+			S049_ClusterCapacity, len(history), span, util.HumanizeBytesF(totalBytesPerDay),
+			util.HumanizeBytes(totalHeadroom), watermark, clusterProjection, formatDays(pct[0]),
+			formatDays(pct[5]), formatDays(pct[10]),
+		)
+
+		needed := totalBytesPerDay*horizonDays - float64(totalHeadroom)
+		if needed > 0 && len(nodeSizes) > 0 {
+			medianSize := math.PercentilesInt64(nodeSizes, 10)[5]
+			emptyNode := Node{Stats: &stats.Node{}}
+			emptyNode.Stats.Fs.Total.TotalInBytes = medianSize
+			emptyNode.Stats.Fs.Total.AvailableInBytes = medianSize
+			nodeCapacity, err := nodeDiskHeadroom(&emptyNode, watermark)
+			if err != nil {
+				return err
+			}
+			if nodeCapacity > 0 {
+				d.Comment(
+					A047_AdditionalDataNodes, util.HumanizeBytesF(totalBytesPerDay*horizonDays), horizonDays,
+					util.HumanizeBytesF(needed), int(gomath.Ceil(needed/float64(nodeCapacity))),
+					util.HumanizeBytes(medianSize), util.HumanizeBytes(nodeCapacity),
+				)
+			}
+		}
+	}
+
+	// indices growth
+	indices := map[string]growth{}
+	for _, indexName := range d.sortedIndexNames() {
+		times, bytes := []time.Time{}, []int64{}
+		for _, sample := range history {
+			if index, ok := sample.Indices[indexName]; ok && index.Stats != nil {
+				times = append(times, sample.CollectedAt())
+				bytes = append(bytes, index.Stats.Total.Store.SizeInBytes)
+			}
+		}
+		g, ok := fitGrowth(times, bytes)
+		if !ok {
+			continue
+		}
+		indices[indexName] = g
+		d.Comment(
+			I048_IndexGrowth, indexName, util.HumanizeBytes(g.current), util.HumanizeBytesF(g.bytesPerDay),
+			g.samples,
+		)
+	}
+	growing := []string{}
+	for name, g := range indices {
+		if g.bytesPerDay > 0 {
+			growing = append(growing, name)
+		}
+	}
+	if len(growing) > 0 {
+		sort.Slice(growing, func(i int, j int) bool {
+			a, b := indices[growing[i]].bytesPerDay, indices[growing[j]].bytesPerDay
+			if a != b {
+				return a > b
+			}
+			return growing[i] < growing[j]
+		})
+		if len(growing) > topGrowingIndicesToShow {
+			growing = growing[:topGrowingIndicesToShow]
+		}
+		msg := []string{}
+		for _, name := range growing {
+			msg = append(msg, fmt.Sprintf("%s (%s/day)", name, util.HumanizeBytesF(indices[name].bytesPerDay)))
+		}
+		d.Comment(S048_TopGrowingIndices, len(growing), strings.Join(msg, ", "))
+	}
+
+	return nil
+}
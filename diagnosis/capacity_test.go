@@ -0,0 +1,53 @@
+package diagnosis
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"esdoctor/stats"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanCapacity(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	sample := func(day int, used int64) *Diagnostics {
+		node := Node{ID: "n1", Name: "node-1", Stats: &stats.Node{}}
+		node.Stats.Timestamp = start.Add(time.Duration(day)*24*time.Hour).UnixNano() / int64(time.Millisecond)
+		node.Stats.Fs.Total.TotalInBytes = 100 * gb
+		node.Stats.Fs.Total.AvailableInBytes = 100*gb - used
+		index := Index{Name: "logs", Stats: &stats.Index{}}
+		index.Stats.Total.Store.SizeInBytes = used
+		return &Diagnostics{
+			Nodes:   Nodes{All: map[string]*Node{"n1": &node}, Data: map[string]*Node{"n1": &node}},
+			Indices: map[string]*Index{"logs": &index},
+		}
+	}
+
+	// out of order on purpose, samples are sorted by collection time
+	history := []*Diagnostics{sample(2, 30*gb), sample(0, 10*gb), sample(1, 20*gb)}
+	d, err := PlanCapacity(history, WithOutput(NewJSONCommentWriter(&bytes.Buffer{}, false)))
+	assert.NoError(t, err)
+
+	codes := commentsByCode(d)
+	// 60gb left below the 90% high watermark, growing 10gb per day
+	assert.Contains(t, codes["I047"][0], "growing 10.0gb per day over 3 samples")
+	assert.Contains(t, codes["S047"][0], "node-1: 6.0 days")
+	assert.Contains(t, codes, "W047")
+	// 900gb of growth over 90 days, 840gb more than the headroom, in 90gb nodes
+	assert.Contains(t, codes["A047"][0], "about 10 additional data nodes")
+	assert.Contains(t, codes["I048"][0], "growing 10.0gb per day")
+
+	_, err = PlanCapacity(history[:1])
+	assert.Error(t, err)
+
+	// samples usually come from json dumps
+	dump := bytes.Buffer{}
+	assert.NoError(t, history[0].JSONDump(&dump))
+	loaded, err := LoadJSONDump(&dump)
+	assert.NoError(t, err)
+	assert.Equal(t, history[0].CollectedAt(), loaded.CollectedAt())
+	assert.Equal(t, int64(30*gb), loaded.Indices["logs"].Stats.Total.Store.SizeInBytes)
+}
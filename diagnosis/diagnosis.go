@@ -19,6 +19,15 @@ func Diagnose(ctx context.Context, client client.Versioned, options ...Option) (
 	return diagnostics, diagnostics.Run(ctx)
 }
 
+// Only loads the supporting data, without running any diagnostics
+func Load(ctx context.Context, client client.Versioned, options ...Option) (*Diagnostics, error) {
+	diagnostics := NewDiagnostics(client, options...)
+	if err := diagnostics.load(ctx); err != nil {
+		return diagnostics, fmt.Errorf("failed to load data for diagnistics: %w", err)
+	}
+	return diagnostics, nil
+}
+
 func (d *Diagnostics) Run(ctx context.Context) error {
 	log.Infof("Running diagnostics on endpoint %s with the following config: %+v", d.client.Endpoint(), d.config)
 
@@ -61,9 +70,14 @@ func (e *DiagnosticsError) Error() string {
 }
 
 func (d *Diagnostics) process(ctx context.Context) error {
+	methods := diagnosticsMethods
+	if d.config.simulation != nil {
+		methods = simulationMethods
+	}
 	errors := []error{}
-	for _, fn := range diagnosticsMethods {
+	for _, fn := range methods {
 		if err := fn(d, ctx); err != nil {
+			log.Error(err)
 			errors = append(errors, err)
 		}
 	}
@@ -79,17 +93,11 @@ func (d *Diagnostics) process(ctx context.Context) error {
 //
 
 // TODO things to look for:
-// - read and write rate per index. Avg latency per query, avg fetches per query
 // - sharding vs num of nodes
 // - balance between nodes
 // - cluster colour, down to shard level
-// - slowlog configs
-// - refresh rate
-// - flush rate
 // - thread pools
-// - master pending tasks
 // - thread pool queue sizes
-// - hot threads ?
 
 var diagnosticsMethods = []func(*Diagnostics, context.Context) error{
 	(*Diagnostics).processClusterHealth,
@@ -98,6 +106,32 @@ var diagnosticsMethods = []func(*Diagnostics, context.Context) error{
 	(*Diagnostics).processNodesBalance,
 	(*Diagnostics).processNodesDiskSizes,
 	(*Diagnostics).processLuceneSegments,
+	(*Diagnostics).processAllocationExplanations,
+	(*Diagnostics).processPendingTasks,
+	(*Diagnostics).processClusterStatePublishing,
+	(*Diagnostics).processTasks,
+	(*Diagnostics).processHotThreads,
+	(*Diagnostics).processMappings,
+	(*Diagnostics).processMerges,
+	(*Diagnostics).processRefreshFlushTranslog,
+	(*Diagnostics).processSlowlogs,
+	(*Diagnostics).processWorkload,
+	(*Diagnostics).processRates,
+	(*Diagnostics).processCaches,
+	(*Diagnostics).processTopology,
+	(*Diagnostics).processVersions,
+	(*Diagnostics).processAwareness,
+	(*Diagnostics).processLifecycle,
+	(*Diagnostics).processSnapshots,
+	(*Diagnostics).processTemplates,
+	(*Diagnostics).processAliases,
+	(*Diagnostics).processIndexStates,
+	(*Diagnostics).processStaleIndices,
+	(*Diagnostics).processFamilies,
+}
+
+var simulationMethods = []func(*Diagnostics, context.Context) error{
+	(*Diagnostics).processSimulation,
 }
 
 const S001_ClusterGreen = "S001: " +
@@ -175,15 +209,67 @@ const S003_Replicas = "S003: " +
 func (d *Diagnostics) processReplicas(ctx context.Context) error {
 	totalNodes := len(d.Nodes.Data)
 	distribution := map[int]int{}
+	// W003 suggests restoring from a snapshot, so we warn when there is none to restore from
+	snapshotted, snapshotsKnown := d.snapshottedIndices()
+	openIndices, autoExpanded, restricted, impossible := 0, 0, 0, 0
 	for indexName, index := range d.Indices {
+		if index.Closed() {
+			continue
+		}
+		openIndices++
 		numNodes := len(index.Nodes)
 		denom, div, percentage := math.Fraction(int64(numNodes), int64(totalNodes))
 		replicas, err := strconv.Atoi(index.Metadata.Settings.Index.NumberOfReplicas)
 		if err != nil {
 			log.Errorf("failed to read number of replicas for index %s: %v", indexName, err)
-		} else if replicas == 0 {
+			continue
+		}
+
+		eligible, restrictions := d.eligibleNodes(index)
+		if restrictions != "" {
+			restricted++
+		}
+		// elasticsearch keeps the number of replicas of auto-expanded indices within the range,
+		// according to the nodes able to hold them
+		_, maxReplicas, isAutoExpanded := autoExpandReplicas(index)
+		if isAutoExpanded {
+			autoExpanded++
+			d.Comment(
+				I076_AutoExpandReplicas, indexName, index.Metadata.Settings.Index.AutoExpandReplicas, replicas,
+				len(eligible),
+			)
+		}
+		if totalNodes > 0 {
+			copies := settingInt(index.Metadata.Settings.Index.NumberOfShards, 1) * (replicas + 1)
+			maxShardsPerNode := settingInt(index.Metadata.Settings.Index.Routing.Allocation.TotalShardsPerNode, -1)
+			if len(eligible) == 0 {
+				d.Comment(W077_NoEligibleNodes, indexName, restrictions)
+				impossible++
+			} else if replicas >= len(eligible) {
+				if restrictions == "" {
+					restrictions = "all the data nodes"
+				}
+				d.Comment(
+					W076_ReplicasExceedNodes, indexName, replicas, len(eligible), restrictions,
+					replicas+1-len(eligible), indexName, len(eligible)-1, len(eligible)-1,
+				)
+				impossible++
+			} else if maxShardsPerNode > 0 && copies > maxShardsPerNode*len(eligible) {
+				d.Comment(
+					W078_TotalShardsPerNodeTooLow, indexName, copies, maxShardsPerNode, len(eligible),
+					maxShardsPerNode*len(eligible),
+				)
+				impossible++
+			}
+		}
+
+		// auto-expanded indices get replicas as soon as there are nodes for them
+		if replicas == 0 && (!isAutoExpanded || maxReplicas == 0) {
 			d.Comment(W003_NoReplicas, indexName, numNodes, totalNodes, percentage, denom, div)
-		} else if replicas > 2 {
+			if _, ok := snapshotted[indexName]; snapshotsKnown && !ok {
+				d.Comment(W061_NoReplicasNoSnapshot, indexName)
+			}
+		} else if replicas > 2 && !index.Hidden && !isAutoExpanded {
 			d.Comment(A003_HighReplicas, indexName, replicas, numNodes, totalNodes, percentage, denom, div)
 		} else {
 			d.Comment(I003_Replicas, indexName, replicas, numNodes, totalNodes, percentage, denom, div)
@@ -192,7 +278,10 @@ func (d *Diagnostics) processReplicas(ctx context.Context) error {
 	}
 
 	for replicas, count := range distribution {
-		d.Comment(S003_Replicas, count, len(d.Indices), math.Pct(count, len(d.Indices)), replicas)
+		d.Comment(S003_Replicas, count, openIndices, math.Pct(count, openIndices), replicas)
+	}
+	if autoExpanded > 0 || restricted > 0 || impossible > 0 {
+		d.Comment(S076_ReplicaPlacement, autoExpanded, restricted, impossible)
 	}
 
 	return nil
@@ -217,14 +306,16 @@ func (d *Diagnostics) processShardStates(ctx context.Context) error {
 		if !shard.State.Primary {
 			shardType = "replica"
 		}
-		stats := shard.Stats
-		avgDocSize := float64(stats.Store.SizeInBytes) / float64(stats.Docs.Count)
-		d.Comment(
-			I004_ShardState, shardType, shard.ID, shard.IndexName, shard.State.State,
-			shard.NodeName, stats.Docs.Count, util.HumanizeBytes(stats.Store.SizeInBytes),
-			util.HumanizeBytesF(avgDocSize), stats.Segments.Count,
-			util.HumanizeBytes(int64(stats.Segments.MemoryInBytes)),
-		)
+		// unassigned shards have no stats
+		if stats := shard.Stats; stats != nil {
+			avgDocSize := float64(stats.Store.SizeInBytes) / float64(stats.Docs.Count)
+			d.Comment(
+				I004_ShardState, shardType, shard.ID, shard.IndexName, shard.State.State,
+				shard.NodeName, stats.Docs.Count, util.HumanizeBytes(stats.Store.SizeInBytes),
+				util.HumanizeBytesF(avgDocSize), stats.Segments.Count,
+				util.HumanizeBytes(int64(stats.Segments.MemoryInBytes)),
+			)
+		}
 		if shard.State.State != "STARTED" {
 			d.Comment(W004_ShardState, shardType, shard.ID, shard.IndexName, shard.State.State)
 		}
@@ -271,20 +362,26 @@ func (d *Diagnostics) processNodesBalance(ctx context.Context) error {
 	aboveThreshold := p50 * (1.0 + unbalanceDiskUsageWarningFactor)
 	belowThreshold := p50 * (1.0 - unbalanceDiskUsageWarningFactor)
 
+	unbalanced := false
 	for _, node := range d.Nodes.Data {
 		usage := float64(node.Stats.Fs.Total.TotalInBytes - node.Stats.Fs.Total.AvailableInBytes)
 		if usage > aboveThreshold {
+			unbalanced = true
 			d.Comment(
 				W005_NodeStorageUnbalanced, node.Name, "above", warningPercentage,
 				util.HumanizeBytesF(usage), util.HumanizeBytesF(p50),
 			)
 		} else if usage < belowThreshold {
+			unbalanced = true
 			d.Comment(
 				W005_NodeStorageUnbalanced, node.Name, "below", warningPercentage,
 				util.HumanizeBytesF(usage), util.HumanizeBytesF(p50),
 			)
 		}
 	}
+	if unbalanced {
+		d.commentRebalancePlan()
+	}
 	return nil
 }
 
@@ -320,6 +417,9 @@ func (d *Diagnostics) processLuceneSegments(ctx context.Context) error {
 	memoryDistribution := map[string]int64{}
 	var memoryTotal int64
 	for _, shard := range d.Shards {
+		if shard.Stats == nil {
+			continue
+		}
 		memoryTotal += int64(shard.Stats.Segments.MemoryInBytes)
 		memoryDistribution["terms"] += int64(shard.Stats.Segments.TermsMemoryInBytes)
 		memoryDistribution["stored_fields"] += int64(shard.Stats.Segments.StoredFieldsMemoryInBytes)
@@ -0,0 +1,135 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const S073_IndexFamilies = "S073: " +
+	"%d index families checked for consistent settings, %d of them with indices deviating from the majority"
+
+const W073_IndexFamilyDeviatingSettings = "W073: " +
+	"%d of the %d indices of %s have a different %s than the rest (%s): %s. If the majority value is " +
+	"the intended one, %s, and make sure %s"
+
+// min number of indices in a family to tell the majority value of a setting apart
+const minFamilySize = 3
+
+// max number of deviating indices listed in W073
+const deviatingIndicesToShow = 10
+
+// family settings that cannot be updated on open indices
+var staticFamilySettings = map[string]bool{"index.number_of_shards": true, "index.codec": true}
+
+// How to bring the deviating indices to the majority value of the setting, for W073
+func alignFamilySetting(setting string, majority string, deviating []string) string {
+	if staticFamilySettings[setting] {
+		return fmt.Sprintf("reindex the deviating indices, as %s cannot be updated on existing ones", setting)
+	}
+	target := "<index>"
+	if len(deviating) <= deviatingIndicesToShow {
+		target = strings.Join(deviating, ",")
+	}
+	// unset settings are reset to their default with null
+	value := "null"
+	if majority != "unset" {
+		value = strconv.Quote(majority)
+	}
+	return fmt.Sprintf("apply it with PUT %s/_settings {%q: %s}", target, setting, value)
+}
+
+// Groups the indices expected to share their settings: time series by their name without the date
+// suffix, the rest by the template they are created from. Data stream backing indices are left out,
+// as W069 compares them. Keys describe the family, eg "family logs-*" or "template products"
+func (d *Diagnostics) indexFamilies(templates []*indexTemplate) map[string][]*Index {
+	result := map[string][]*Index{}
+	for _, indexName := range d.sortedIndexNames() {
+		index := d.Indices[indexName]
+		if index.Closed() || index.Metadata == nil || strings.HasPrefix(indexName, ".") {
+			continue
+		}
+		if family, ok := timeSeriesFamily(indexName); ok {
+			key := fmt.Sprintf("family %s", family)
+			result[key] = append(result[key], index)
+		} else if template := appliedTemplate(templates, indexName); template != nil && !template.managed {
+			key := fmt.Sprintf("template %s", template.name)
+			result[key] = append(result[key], index)
+		}
+	}
+	return result
+}
+
+func (d *Diagnostics) processFamilies(ctx context.Context) error {
+	var templates []*indexTemplate
+	if d.Cluster != nil {
+		templates = d.indexTemplates()
+	}
+	families := d.indexFamilies(templates)
+	keys := []string{}
+	for key, indices := range families {
+		if len(indices) >= minFamilySize {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+
+	inconsistent := 0
+	for _, key := range keys {
+		indices := families[key]
+		// new indices of the family are created like the most recent one
+		source := "the requests creating new indices set it, as no template matches them"
+		if template := appliedTemplate(templates, indices[len(indices)-1].Name); template != nil {
+			source = fmt.Sprintf("template %s sets it for new indices", template.name)
+		}
+		deviates := false
+		for _, setting := range familySettings {
+			values := map[string]string{}
+			counts := map[string]int{}
+			for _, index := range indices {
+				if value, ok := setting.indexValue(index); ok {
+					values[index.Name] = value
+					counts[value]++
+				}
+			}
+			// without a clear majority there is no telling which value is intended
+			majority, majorityCount := "", 0
+			for value, count := range counts {
+				if count > majorityCount || (count == majorityCount && value < majority) {
+					majority, majorityCount = value, count
+				}
+			}
+			if len(counts) < 2 || majorityCount*2 <= len(values) {
+				continue
+			}
+
+			deviating, names := []string{}, []string{}
+			for _, index := range indices {
+				if value, ok := values[index.Name]; ok && value != majority {
+					deviating = append(deviating, fmt.Sprintf("%s (%s)", index.Name, value))
+					names = append(names, index.Name)
+				}
+			}
+			count := len(deviating)
+			if count > deviatingIndicesToShow {
+				deviating = append(deviating[:deviatingIndicesToShow], "...")
+			}
+			d.Comment(
+				W073_IndexFamilyDeviatingSettings, count, len(values), key, setting.name, majority,
+				strings.Join(deviating, ", "), alignFamilySetting(setting.name, majority, names), source,
+			)
+			deviates = true
+		}
+		if deviates {
+			inconsistent++
+		}
+	}
+	d.Comment(S073_IndexFamilies, len(keys), inconsistent)
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package diagnosis
+
+import (
+	"context"
+	"testing"
+
+	"esdoctor/metadata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessFamilies(t *testing.T) {
+	d := Diagnostics{
+		Cluster: &Cluster{
+			State: &metadata.ClusterState{},
+			Templates: &metadata.IndexTemplates{
+				Composable: map[string]metadata.ComposableTemplate{
+					"products": {IndexPatterns: []string{"products-*"}},
+					"metrics":  {IndexPatterns: []string{"metrics-*"}},
+				},
+			},
+		},
+		Indices: map[string]*Index{},
+	}
+	addIndex := func(name string, shards string, refreshInterval string) *Index {
+		index := Index{Name: name, State: metadata.IndexStateOpen, Metadata: &metadata.Index{}}
+		index.Metadata.Settings.Index.NumberOfShards = shards
+		index.Metadata.Settings.Index.RefreshInterval = refreshInterval
+		d.Indices[name] = &index
+		return &index
+	}
+	addIndex("logs-2021.01.01", "1", "")
+	addIndex("logs-2021.01.02", "1", "")
+	addIndex("logs-2021.01.03", "2", "30s")
+	// shrunk by its lifecycle policy
+	addIndex("logs-2021.01.04", "3", "").Lifecycle = &metadata.IndexLifecycle{Phase: "warm"}
+	addIndex("products-books", "1", "1s")
+	addIndex("products-music", "1", "5s")
+	addIndex("products-games", "1", "")
+	addIndex("metrics-2021.01", "1", "")
+	addIndex("metrics-2021.02", "1", "")
+	addIndex("metrics-2021.03", "1", "5s")
+
+	assert.NoError(t, d.processFamilies(context.Background()))
+	codes := commentsByCode(&d)
+	assert.Equal(t, []string{
+		"1 of the 3 indices of family logs-* have a different index.number_of_shards than the rest (1): " +
+			"logs-2021.01.03 (2). If the majority value is the intended one, reindex the deviating indices, " +
+			"as index.number_of_shards cannot be updated on existing ones, and make sure the requests creating " +
+			"new indices set it, as no template matches them",
+		"1 of the 4 indices of family logs-* have a different index.refresh_interval than the rest (unset): " +
+			"logs-2021.01.03 (30s). If the majority value is the intended one, apply it with PUT " +
+			"logs-2021.01.03/_settings {\"index.refresh_interval\": null}, and make sure the requests creating " +
+			"new indices set it, as no template matches them",
+		"1 of the 3 indices of family metrics-* have a different index.refresh_interval than the rest " +
+			"(unset): metrics-2021.03 (5s). If the majority value is the intended one, apply it with PUT " +
+			"metrics-2021.03/_settings {\"index.refresh_interval\": null}, and make sure template metrics sets " +
+			"it for new indices",
+	}, codes["W073"])
+	assert.Equal(t, []string{"3 index families checked for consistent settings, 2 of them with indices deviating from the majority"}, codes["S073"])
+}
@@ -0,0 +1,10 @@
+package diagnosis
+
+// Messages of the comments made so far, grouped by their code
+func commentsByCode(d *Diagnostics) map[string][]string {
+	result := map[string][]string{}
+	for _, c := range d.Comments() {
+		result[c.Code] = append(result[c.Code], c.Message)
+	}
+	return result
+}
@@ -0,0 +1,85 @@
+package diagnosis
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// formats the top most frequent keys of the given counts, eg "a (10), b (5), c (1)"
+func topCounts(counts map[string]int, top int) string {
+	keys := []string{}
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	// reverse sort from most to least frequent, breaking ties by key so the output is stable
+	sort.Slice(keys, func(i int, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > top {
+		keys = keys[:top]
+	}
+	msg := []string{}
+	for _, key := range keys {
+		msg = append(msg, fmt.Sprintf("%s (%d)", key, counts[key]))
+	}
+	return strings.Join(msg, ", ")
+}
+
+// Index settings come as strings. Parses a numeric setting, returning the default value in case
+// the setting is not set or not a valid number
+func settingInt(value string, defaultValue int) int {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue
+	}
+	return parsed
+}
+
+// index names sorted alphabetically, so comments about indices are generated in a stable order
+func (d *Diagnostics) sortedIndexNames() []string {
+	names := make([]string, 0, len(d.Indices))
+	for name := range d.Indices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Whether an index name matches an index pattern as used by index templates, where * matches any
+// sequence of characters
+func matchesIndexPattern(pattern string, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == name
+	}
+	if !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+	name = name[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(name, part)
+		if idx < 0 {
+			return false
+		}
+		name = name[idx+len(part):]
+	}
+	return strings.HasSuffix(name, last)
+}
+
+// nodes sorted by name, so comments about nodes are generated in a stable order
+func sortedNodes(nodes map[string]*Node) []*Node {
+	result := make([]*Node, 0, len(nodes))
+	for _, node := range nodes {
+		result = append(result, node)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
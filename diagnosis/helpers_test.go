@@ -0,0 +1,30 @@
+package diagnosis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchesIndexPattern(t *testing.T) {
+	test := func(pattern string, name string, expected bool) {
+		assert.Equal(
+			t, expected, matchesIndexPattern(pattern, name),
+			"matching %q against pattern %q should be %v", name, pattern, expected,
+		)
+	}
+
+	test("logs", "logs", true)
+	test("logs", "logs-1", false)
+	test("*", "anything", true)
+	test("*", "", true)
+	test("logs-*", "logs-2026.10.18", true)
+	test("logs-*", "logs-", true)
+	test("logs-*", "metrics-2026.10.18", false)
+	test("*-logs", "app-logs", true)
+	test("*-logs", "app-logs-1", false)
+	test("logs-*-prod-*", "logs-app-prod-2026.10.18", true)
+	test("logs-*-prod-*", "logs-app-dev-2026.10.18", false)
+	test("a*a", "a", false)
+	test("a*a", "aa", true)
+}
@@ -0,0 +1,170 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"esdoctor/hotthreads"
+)
+
+const I013_NodeHotThreadsPools = "I013: " +
+	"Node %s %s hot threads usage by thread pool (in %% of a cpu core): %s"
+
+const S013_HotThreadsPools = "S013: " +
+	"Hot threads %s usage by thread pool across %d nodes (in %% of a cpu core): %s"
+
+const W013_HotThreadsPoolDominating = "W013: " +
+	"Node %s hot threads cpu usage is dominated by the %s thread pool, which is using %.1f%% of a cpu " +
+	"core (%.1f%% of the sampled hot threads cpu usage of %.1f%%). Most common stack frame: %q. %s"
+
+// Hints on what to look for when a given thread pool dominates the cpu usage of a node
+var hotThreadsPoolHints = map[string]string{
+	hotthreads.PoolMerge: "Segment merges are consuming most of the cpu. Check the indexing rate of the " +
+		"indices with shards in this node, updates/deletes causing deleted documents to be merged " +
+		"away and too frequent refreshes creating many small segments (index.refresh_interval)",
+	"refresh": "Refreshes are consuming most of the cpu. Consider increasing index.refresh_interval " +
+		"on write heavy indices, particularly the ones that do not need near real time search",
+	"flush": "Flushes are consuming most of the cpu. Check the index.translog.flush_threshold_size " +
+		"setting and the indexing rate of the indices with shards in this node",
+	"search": "Searches are consuming most of the cpu. Check for expensive queries and aggregations " +
+		"using the search slowlog and the _tasks api, and whether searches are well distributed " +
+		"across the replicas of each shard",
+	"search_throttled": "Searches on frozen/throttled indices are consuming most of the cpu. Check the " +
+		"queries being run against these indices",
+	"write": "Indexing is consuming most of the cpu. Check the bulk request sizes, ingest pipelines, " +
+		"mapping complexity (eg many fields or expensive analyzers) and whether indexing is well " +
+		"distributed across the data nodes",
+	"bulk": "Indexing is consuming most of the cpu. Check the bulk request sizes, ingest pipelines, " +
+		"mapping complexity (eg many fields or expensive analyzers) and whether indexing is well " +
+		"distributed across the data nodes",
+	"index": "Single document indexing is consuming most of the cpu. Prefer the _bulk api over " +
+		"indexing documents one by one",
+	"get": "Realtime get requests are consuming most of the cpu. Check for clients fetching many " +
+		"documents one by one instead of using _mget or searches",
+	"management": "Management tasks (eg stats collection) are consuming most of the cpu. Check for " +
+		"monitoring tools polling the stats apis too frequently",
+	"transport_worker": "Network (de)serialization is consuming most of the cpu. Check for large " +
+		"requests/responses, like big bulk requests or searches returning many documents",
+	"generic": "Generic tasks (eg shard recoveries) are consuming most of the cpu. Check for " +
+		"ongoing recoveries with GET _cat/recovery?active_only=true",
+	"snapshot": "Snapshots are consuming most of the cpu. Check the running snapshots with " +
+		"GET _snapshot/_status",
+}
+
+// min cpu usage (in % of a cpu core) a thread pool needs to have in a node to be considered dominating
+// TODO make it configurable
+const hotThreadsPoolUsageWarning float64 = 50.0
+
+// min share of the node sampled hot threads cpu usage a thread pool needs to be considered dominating
+const hotThreadsPoolDominanceFactor float64 = 0.5 // 50%
+
+func (d *Diagnostics) processHotThreads(ctx context.Context) error {
+	if d.HotThreads == nil {
+		return nil
+	}
+	for _, ht := range []*hotthreads.HotThreads{d.HotThreads.CPU, d.HotThreads.Block, d.HotThreads.Wait} {
+		if ht != nil {
+			d.processHotThreadsCollection(ht)
+		}
+	}
+	return nil
+}
+
+func (d *Diagnostics) processHotThreadsCollection(ht *hotthreads.HotThreads) {
+	clusterUsage := map[string]float64{}
+
+	nodeNames := []string{}
+	for name := range ht.Nodes {
+		nodeNames = append(nodeNames, name)
+	}
+	sort.Strings(nodeNames)
+
+	for _, nodeName := range nodeNames {
+		node := ht.Nodes[nodeName]
+		usage := map[string]float64{}
+		frames := map[string]map[string]int{}
+		var total float64
+		for _, thread := range node.Threads {
+			pool := thread.Pool()
+			usage[pool] += thread.UsagePercent
+			clusterUsage[pool] += thread.UsagePercent
+			total += thread.UsagePercent
+			if _, ok := frames[pool]; !ok {
+				frames[pool] = map[string]int{}
+			}
+			for _, summary := range thread.SnapshotSummaries {
+				if frame := summary.TopFrame(); frame != "" {
+					frames[pool][frame] += summary.Occurred
+				}
+			}
+		}
+		if len(usage) == 0 {
+			continue
+		}
+
+		pools := sortedPoolsByUsage(usage)
+		d.Comment(I013_NodeHotThreadsPools, nodeName, ht.Type, formatPoolsUsage(pools, usage))
+
+		// waiting threads are usually idle ones, so only cpu usage tells which pool dominates a node
+		if ht.Type != hotthreads.TypeCPU {
+			continue
+		}
+		top := pools[0]
+		if top == hotthreads.PoolOther || usage[top] < hotThreadsPoolUsageWarning ||
+			usage[top]/total < hotThreadsPoolDominanceFactor {
+			continue
+		}
+		hint, ok := hotThreadsPoolHints[top]
+		if !ok {
+			hint = fmt.Sprintf(
+				"Check what is being executed in the %s thread pool with GET _nodes/%s/hot_threads",
+				top, nodeName,
+			)
+		}
+		d.Comment(
+			W013_HotThreadsPoolDominating, nodeName, top, usage[top], usage[top]/total*100.0, total,
+			mostCommonFrame(frames[top]), hint,
+		)
+	}
+
+	if len(clusterUsage) > 0 {
+		d.Comment(
+			S013_HotThreadsPools, ht.Type, len(ht.Nodes),
+			formatPoolsUsage(sortedPoolsByUsage(clusterUsage), clusterUsage),
+		)
+	}
+}
+
+func sortedPoolsByUsage(usage map[string]float64) []string {
+	pools := []string{}
+	for pool := range usage {
+		pools = append(pools, pool)
+	}
+	// reverse sort from highest to lowest usage
+	sort.Slice(pools, func(i int, j int) bool {
+		return usage[pools[i]] > usage[pools[j]]
+	})
+	return pools
+}
+
+func formatPoolsUsage(pools []string, usage map[string]float64) string {
+	msg := []string{}
+	for _, pool := range pools {
+		msg = append(msg, fmt.Sprintf("%s %.1f%%", pool, usage[pool]))
+	}
+	return strings.Join(msg, ", ")
+}
+
+func mostCommonFrame(frames map[string]int) string {
+	result := ""
+	count := 0
+	for frame, c := range frames {
+		if c > count || (c == count && frame < result) {
+			result = frame
+			count = c
+		}
+	}
+	return result
+}
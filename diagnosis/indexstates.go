@@ -0,0 +1,103 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"esdoctor/util"
+)
+
+const S071_IndexStates = "S071: " +
+	"%d indices are open, %d closed, %d frozen and %d hidden"
+
+const W071_ClosedIndicesDisk = "W071: " +
+	"%d closed indices hold %s of disk in %d shard copies: %s. Closed indices can be neither " +
+	"searched nor written to, but their shards still take disk space and count towards the shards " +
+	"per node limit. Delete the ones no longer needed, snapshotting them first in case they are " +
+	"needed again"
+
+const A072_UnsearchedFrozenIndices = "A072: " +
+	"%d frozen indices (%s) have not been searched since their shards started: %s. Frozen indices " +
+	"are deprecated since Elasticsearch 7.14 in favor of searchable snapshots. Delete the ones no " +
+	"longer needed, or snapshot them and mount the snapshots instead"
+
+// max number of indices listed in W071 and A072
+const indexStatesToShow = 10
+
+func (d *Diagnostics) processIndexStates(ctx context.Context) error {
+	open, frozen, hidden := 0, 0, 0
+	closed, unsearchedFrozen := []*Index{}, []*Index{}
+	closedShards := 0
+	var closedBytes, unsearchedFrozenBytes int64
+	closedSizeKnown := false
+	for _, indexName := range d.sortedIndexNames() {
+		index := d.Indices[indexName]
+		if index.Hidden {
+			hidden++
+		}
+		if index.Closed() {
+			closed = append(closed, index)
+			closedShards += len(index.Shards)
+			if index.Stats != nil {
+				closedSizeKnown = true
+				closedBytes += index.Stats.Total.Store.SizeInBytes
+			}
+			continue
+		}
+		open++
+		if !index.Frozen {
+			continue
+		}
+		frozen++
+		if index.Stats != nil && index.Stats.Total.Search.QueryTotal == 0 {
+			unsearchedFrozen = append(unsearchedFrozen, index)
+			unsearchedFrozenBytes += index.Stats.Total.Store.SizeInBytes
+		}
+	}
+	d.Comment(S071_IndexStates, open, len(closed), frozen, hidden)
+
+	// largest first
+	formatIndices := func(indices []*Index) string {
+		sort.SliceStable(indices, func(i int, j int) bool {
+			return indexStoreSize(indices[i]) > indexStoreSize(indices[j])
+		})
+		msg := []string{}
+		for _, index := range indices {
+			if index.Stats == nil {
+				msg = append(msg, index.Name)
+				continue
+			}
+			msg = append(msg, fmt.Sprintf("%s (%s)", index.Name, util.HumanizeBytes(indexStoreSize(index))))
+		}
+		if len(msg) > indexStatesToShow {
+			msg = append(msg[:indexStatesToShow], "...")
+		}
+		return strings.Join(msg, ", ")
+	}
+
+	if len(closed) > 0 {
+		size := "an unknown amount"
+		if closedSizeKnown {
+			size = util.HumanizeBytes(closedBytes)
+		}
+		d.Comment(W071_ClosedIndicesDisk, len(closed), size, closedShards, formatIndices(closed))
+	}
+	if len(unsearchedFrozen) > 0 {
+		d.Comment(
+			A072_UnsearchedFrozenIndices, len(unsearchedFrozen), util.HumanizeBytes(unsearchedFrozenBytes),
+			formatIndices(unsearchedFrozen),
+		)
+	}
+
+	return nil
+}
+
+// Disk used by all the copies of an index, 0 when unknown
+func indexStoreSize(index *Index) int64 {
+	if index.Stats == nil {
+		return 0
+	}
+	return index.Stats.Total.Store.SizeInBytes
+}
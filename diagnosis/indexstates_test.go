@@ -0,0 +1,36 @@
+package diagnosis
+
+import (
+	"context"
+	"testing"
+
+	"esdoctor/metadata"
+	"esdoctor/stats"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessIndexStates(t *testing.T) {
+	d := Diagnostics{Indices: map[string]*Index{}}
+	addIndex := func(name string, state string, size int64, queries int) *Index {
+		index := Index{Name: name, State: state, Stats: &stats.Index{}, Shards: []*Shard{{}, {}}}
+		index.Stats.Total.Store.SizeInBytes = size
+		index.Stats.Total.Search.QueryTotal = queries
+		d.Indices[name] = &index
+		return &index
+	}
+	addIndex("logs-2021", metadata.IndexStateClose, 1024*1024*1024, 0)
+	addIndex("logs-2020", metadata.IndexStateClose, 2*1024*1024*1024, 0)
+	addIndex("logs-2022", metadata.IndexStateOpen, 1024, 10)
+	addIndex("archive-2019", metadata.IndexStateOpen, 1024*1024, 0).Frozen = true
+	addIndex("archive-2018", metadata.IndexStateOpen, 1024*1024, 5).Frozen = true
+	addIndex(".tasks", metadata.IndexStateOpen, 1024, 0).Hidden = true
+
+	assert.NoError(t, d.processIndexStates(context.Background()))
+	codes := commentsByCode(&d)
+	assert.Equal(t, []string{"4 indices are open, 2 closed, 2 frozen and 1 hidden"}, codes["S071"])
+	assert.Len(t, codes["W071"], 1)
+	assert.Contains(t, codes["W071"][0], "2 closed indices hold 3.0gb of disk in 4 shard copies: logs-2020 (2.0gb), logs-2021 (1.0gb)")
+	assert.Len(t, codes["A072"], 1)
+	assert.Contains(t, codes["A072"][0], "1 frozen indices (1.0mb) have not been searched since their shards started: archive-2019 (1.0mb)")
+}
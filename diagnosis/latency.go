@@ -0,0 +1,279 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"esdoctor/math"
+	"esdoctor/stats"
+)
+
+const I021_IndexWorkload = "I021: " +
+	"Index %s had %d queries (avg latency of %v), %d fetches (avg latency of %v, %.2f fetches per " +
+	"query), %d scrolls (avg duration of %v) and %d indexing operations (avg latency of %v) since " +
+	"nodes started"
+
+const I022_NodeWorkload = "I022: " +
+	"Node %s had %d queries (avg latency of %v), %d fetches (avg latency of %v, %.2f fetches per " +
+	"query), %d scrolls (avg duration of %v) and %d indexing operations (avg latency of %v) since it " +
+	"started. It currently has %d open search contexts and %d scrolls"
+
+const S021_TopIndices = "S021: " +
+	"Top %d indices by %s: %s"
+
+const W021_IndexLatencyOutlier = "W021: " +
+	"Index %s has an average %s latency of %v, %.1f times the median of %v across the %d indices " +
+	"with at least %d operations. Check the queries/documents sent to this index, its mapping and " +
+	"its shard sizes"
+
+const W022_NodeLatencyOutlier = "W022: " +
+	"Node %s has an average %s latency of %v, %.1f times the median of %v across the %d nodes with " +
+	"at least %d operations. As nodes usually serve the same kind of requests, this may indicate a " +
+	"hardware problem (eg a slow disk), a noisy neighbour or hot shards allocated in this node"
+
+const A021_OpenScrolls = "A021: " +
+	"Node %s has %d open scrolls and %d open search contexts. Each open scroll keeps the segments " +
+	"it is reading from being deleted, holding disk space and file handles. Make sure clients clear " +
+	"scrolls when done with DELETE _search/scroll and use short keep alive values, or prefer " +
+	"search_after with point in time"
+
+// how many indices are shown in the top indices summaries
+const topIndicesToShow = 10
+
+// min number of operations of an index/node for its latency to be considered
+const latencyMinOperations = 1000
+
+// how many times over the median latency an index/node needs to be to be flagged as an outlier
+// TODO make it configurable
+const latencyOutlierFactor float64 = 3.0
+
+// min number of open scrolls in a node before we advise about them
+const openScrollsAdvice = 500
+
+// Workload counters and average latencies of a set of lucene stats
+type workload struct {
+	queries            int
+	fetches            int
+	scrolls            int
+	indexing           int
+	avgQueryLatency    time.Duration
+	avgFetchLatency    time.Duration
+	avgScrollDuration  time.Duration
+	avgIndexingLatency time.Duration
+	fetchesPerQuery    float64
+	openContexts       int
+	currentScrolls     int
+	// only available when sampling
+	sampled           bool
+	indexingPerSecond float64
+	queriesPerSecond  float64
+}
+
+func newWorkload(l *stats.Lucene) workload {
+	result := workload{
+		queries:            l.Search.QueryTotal,
+		fetches:            l.Search.FetchTotal,
+		scrolls:            l.Search.ScrollTotal,
+		indexing:           l.Indexing.IndexTotal,
+		avgQueryLatency:    avgMillis(l.Search.QueryTimeInMillis, l.Search.QueryTotal),
+		avgFetchLatency:    avgMillis(l.Search.FetchTimeInMillis, l.Search.FetchTotal),
+		avgScrollDuration:  avgMillis(l.Search.ScrollTimeInMillis, l.Search.ScrollTotal),
+		avgIndexingLatency: avgMillis(l.Indexing.IndexTimeInMillis, l.Indexing.IndexTotal),
+		openContexts:       l.Search.OpenContexts,
+		currentScrolls:     l.Search.ScrollCurrent,
+	}
+	if l.Search.QueryTotal > 0 {
+		result.fetchesPerQuery = float64(l.Search.FetchTotal) / float64(l.Search.QueryTotal)
+	}
+	return result
+}
+
+func (d *Diagnostics) processWorkload(ctx context.Context) error {
+	indices := map[string]workload{}
+	for _, indexName := range d.sortedIndexNames() {
+		index := d.Indices[indexName]
+		// frozen indices are expected to be slow to search
+		if index.Stats == nil || index.Closed() || index.Frozen {
+			continue
+		}
+		w := newWorkload(&index.Stats.Total)
+		if index.Rates != nil && !index.Rates.Reset {
+			w.sampled = true
+			w.indexingPerSecond = index.Rates.IndexingPerSecond
+			w.queriesPerSecond = index.Rates.QueriesPerSecond
+		}
+		indices[indexName] = w
+		d.Comment(
+			I021_IndexWorkload, indexName, w.queries, w.avgQueryLatency, w.fetches, w.avgFetchLatency,
+			w.fetchesPerQuery, w.scrolls, w.avgScrollDuration, w.indexing, w.avgIndexingLatency,
+		)
+	}
+
+	nodes := map[string]workload{}
+	for _, node := range sortedNodes(d.Nodes.All) {
+		w := newWorkload(&node.Stats.Indices)
+		nodes[node.Name] = w
+		d.Comment(
+			I022_NodeWorkload, node.Name, w.queries, w.avgQueryLatency, w.fetches, w.avgFetchLatency,
+			w.fetchesPerQuery, w.scrolls, w.avgScrollDuration, w.indexing, w.avgIndexingLatency,
+			w.openContexts, w.currentScrolls,
+		)
+		if w.currentScrolls >= openScrollsAdvice {
+			d.Comment(A021_OpenScrolls, node.Name, w.currentScrolls, w.openContexts)
+		}
+	}
+
+	if len(indices) == 0 {
+		return nil
+	}
+
+	queryLatency := func(w workload) time.Duration { return w.avgQueryLatency }
+	fetchLatency := func(w workload) time.Duration { return w.avgFetchLatency }
+	indexingLatency := func(w workload) time.Duration { return w.avgIndexingLatency }
+	withQueries := func(w workload) bool { return w.queries >= latencyMinOperations }
+	withFetches := func(w workload) bool { return w.fetches >= latencyMinOperations }
+	withIndexing := func(w workload) bool { return w.indexing >= latencyMinOperations }
+
+	d.commentTopIndices(
+		indices, "number of queries", withQueries,
+		func(w workload) float64 { return float64(w.queries) },
+		func(w workload) string { return fmt.Sprintf("%d", w.queries) },
+	)
+	d.commentTopIndices(
+		indices, "number of indexing operations", withIndexing,
+		func(w workload) float64 { return float64(w.indexing) },
+		func(w workload) string { return fmt.Sprintf("%d", w.indexing) },
+	)
+	d.commentTopIndices(
+		indices, "queries per second", func(w workload) bool { return w.sampled && w.queriesPerSecond > 0 },
+		func(w workload) float64 { return w.queriesPerSecond },
+		func(w workload) string { return fmt.Sprintf("%.1f/s", w.queriesPerSecond) },
+	)
+	d.commentTopIndices(
+		indices, "indexing operations per second",
+		func(w workload) bool { return w.sampled && w.indexingPerSecond > 0 },
+		func(w workload) float64 { return w.indexingPerSecond },
+		func(w workload) string { return fmt.Sprintf("%.1f/s", w.indexingPerSecond) },
+	)
+	d.commentTopIndices(
+		indices, "avg query latency", withQueries,
+		func(w workload) float64 { return float64(w.avgQueryLatency) },
+		func(w workload) string { return w.avgQueryLatency.String() },
+	)
+	d.commentTopIndices(
+		indices, "avg indexing latency", withIndexing,
+		func(w workload) float64 { return float64(w.avgIndexingLatency) },
+		func(w workload) string { return w.avgIndexingLatency.String() },
+	)
+
+	for _, check := range []struct {
+		kind    string
+		filter  func(workload) bool
+		latency func(workload) time.Duration
+	}{
+		{"query", withQueries, queryLatency},
+		{"fetch", withFetches, fetchLatency},
+		{"indexing", withIndexing, indexingLatency},
+	} {
+		for _, outlier := range latencyOutliers(indices, check.filter, check.latency) {
+			d.Comment(
+				W021_IndexLatencyOutlier, outlier.name, check.kind, outlier.latency, outlier.factor,
+				outlier.median, outlier.considered, latencyMinOperations,
+			)
+		}
+		for _, outlier := range latencyOutliers(nodes, check.filter, check.latency) {
+			d.Comment(
+				W022_NodeLatencyOutlier, outlier.name, check.kind, outlier.latency, outlier.factor,
+				outlier.median, outlier.considered, latencyMinOperations,
+			)
+		}
+	}
+
+	return nil
+}
+
+func (d *Diagnostics) commentTopIndices(
+	indices map[string]workload,
+	what string,
+	filter func(workload) bool,
+	value func(workload) float64,
+	format func(workload) string,
+) {
+	names := []string{}
+	for name, w := range indices {
+		if filter(w) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	// reverse sort from highest to lowest value
+	sort.Slice(names, func(i int, j int) bool {
+		a, b := value(indices[names[i]]), value(indices[names[j]])
+		if a != b {
+			return a > b
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > topIndicesToShow {
+		names = names[:topIndicesToShow]
+	}
+	msg := []string{}
+	for _, name := range names {
+		msg = append(msg, fmt.Sprintf("%s (%s)", name, format(indices[name])))
+	}
+	d.Comment(S021_TopIndices, len(names), what, strings.Join(msg, ", "))
+}
+
+type latencyOutlier struct {
+	name       string
+	latency    time.Duration
+	median     time.Duration
+	factor     float64
+	considered int
+}
+
+// Finds the entries whose latency is latencyOutlierFactor times above the median latency of all
+// entries passing the filter
+func latencyOutliers(
+	workloads map[string]workload,
+	filter func(workload) bool,
+	latency func(workload) time.Duration,
+) []latencyOutlier {
+	names := []string{}
+	latencies := []int64{}
+	for name, w := range workloads {
+		if filter(w) {
+			names = append(names, name)
+			latencies = append(latencies, int64(latency(w)))
+		}
+	}
+	// an outlier only makes sense with a few entries to compare against
+	if len(names) < 3 {
+		return nil
+	}
+	sort.Strings(names)
+	median := time.Duration(math.PercentilesInt64(latencies, 10)[5])
+	if median <= 0 {
+		return nil
+	}
+	result := []latencyOutlier{}
+	for _, name := range names {
+		l := latency(workloads[name])
+		factor := float64(l) / float64(median)
+		if factor > latencyOutlierFactor {
+			result = append(result, latencyOutlier{
+				name:       name,
+				latency:    l,
+				median:     median,
+				factor:     factor,
+				considered: len(latencies),
+			})
+		}
+	}
+	return result
+}
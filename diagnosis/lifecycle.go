@@ -0,0 +1,194 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"esdoctor/metadata"
+	"esdoctor/util"
+)
+
+const I051_IndexLifecycle = "I051: " +
+	"Index %s is managed by %s policy %s, in the %s %s, action %s and step %s"
+
+const S052_LifecycleSummary = "S052: " +
+	"%d of %d indices are managed by %s policies: %s"
+
+const W051_LifecycleStepFailed = "W051: " +
+	"Index %s is stuck in the %s step of %s policy %s (%s %s, action %s): %s. The index does not " +
+	"move through its lifecycle until the cause is fixed and the step is retried with %s"
+
+const W052_RolloverAliasMissing = "W052: " +
+	"Rollover alias %s does not point to the %s managed indices waiting to be rolled over with it: " +
+	"%s. Rolling them over fails, so they keep receiving writes past the policy rollover " +
+	"conditions. Point the alias at the latest of them with POST _aliases {\"actions\": " +
+	"[{\"add\": {\"index\": %q, \"alias\": %q, \"is_write_index\": true}}]}"
+
+const W053_LifecyclePolicyNeverDeletes = "W053: " +
+	"%s policy %s manages %d indices (%s) but never deletes them, so the data it manages is kept " +
+	"forever and its disk usage only goes up. Add a delete action to its last %s, or make sure these " +
+	"indices are deleted by other means"
+
+const A051_UnmanagedTimeSeriesIndices = "A051: " +
+	"%d time series indices are not managed by any %s policy: %s. Without one they need to be " +
+	"rolled over and deleted by hand, or old ones are never removed as new ones are created. " +
+	"Attach a policy to them, eg through the index templates creating them"
+
+// max number of index families listed in A051
+const unmanagedFamiliesToShow = 20
+
+// date (eg 2021.01.31, 2021-01 or 2021.01.31.23) or rollover generation (eg 000001) suffixes of
+// time series index names
+var timeSeriesSuffix = regexp.MustCompile(`^(.+?)([-_.])(\d{4}[-_.]\d{2}(?:[-_.]\d{2}){0,2}|\d{6})$`)
+
+// Tells whether an index is part of a time series, going by its name, and the pattern matching
+// all the indices of the series. Data stream backing indices are time series as well
+func timeSeriesFamily(name string) (string, bool) {
+	if strings.HasPrefix(name, ".") && !strings.HasPrefix(name, ".ds-") {
+		return "", false // system indices
+	}
+	family, separator := name, ""
+	for {
+		match := timeSeriesSuffix.FindStringSubmatch(family)
+		if match == nil {
+			break
+		}
+		family, separator = match[1], match[2]
+	}
+	if family == name {
+		return "", false
+	}
+	return family + separator + "*", true
+}
+
+// Rollover alias of a managed index, from the ILM or the ISM settings
+func rolloverAlias(index *Index) string {
+	settings := index.Metadata.Settings.Index
+	for _, alias := range []string{
+		settings.Lifecycle.RolloverAlias,
+		settings.Plugins.IndexStateManagement.RolloverAlias,
+		settings.Opendistro.IndexStateManagement.RolloverAlias,
+	} {
+		if alias != "" {
+			return alias
+		}
+	}
+	return ""
+}
+
+// How a lifecycle system names the stages of a policy
+func lifecyclePhaseName(lifecycle *metadata.Lifecycle) string {
+	if lifecycle.System == metadata.LifecycleISM {
+		return "state"
+	}
+	return "phase"
+}
+
+func lifecycleRetryCommand(lifecycle *metadata.Lifecycle, indexName string) string {
+	if lifecycle.System == metadata.LifecycleISM {
+		return fmt.Sprintf("POST %s/retry/%s", lifecycle.API, indexName)
+	}
+	return fmt.Sprintf("POST %s/_ilm/retry", indexName)
+}
+
+func (d *Diagnostics) processLifecycle(ctx context.Context) error {
+	if d.Cluster == nil || d.Cluster.Lifecycle == nil {
+		return nil
+	}
+	lifecycle := d.Cluster.Lifecycle
+	phaseName := lifecyclePhaseName(lifecycle)
+
+	policyIndices := map[string][]string{}
+	policyBytes := map[string]int64{}
+	unmanagedFamilies := map[string]int{}
+	unmanaged := 0
+	// managed indices waiting to be rolled over, by their rollover alias
+	waitingRollover := map[string][]string{}
+	for _, indexName := range d.sortedIndexNames() {
+		index := d.Indices[indexName]
+		state := index.Lifecycle
+		if state == nil {
+			if family, ok := timeSeriesFamily(indexName); ok {
+				unmanagedFamilies[family]++
+				unmanaged++
+			}
+			continue
+		}
+
+		d.Comment(
+			I051_IndexLifecycle, indexName, lifecycle.System, state.Policy, phaseName, state.Phase, state.Action,
+			state.Step,
+		)
+		policyIndices[state.Policy] = append(policyIndices[state.Policy], indexName)
+		if index.Stats != nil {
+			policyBytes[state.Policy] += index.Stats.Total.Store.SizeInBytes
+		}
+		if state.Failed {
+			d.Comment(
+				W051_LifecycleStepFailed, indexName, state.FailedStep, lifecycle.System, state.Policy, phaseName,
+				state.Phase, state.Action, state.Reason, lifecycleRetryCommand(lifecycle, indexName),
+			)
+		}
+
+		alias := rolloverAlias(index)
+		if alias == "" || state.RolledOver || index.Metadata.Settings.Index.Lifecycle.IndexingComplete == "true" {
+			continue
+		}
+		if policy, ok := lifecycle.Policies[state.Policy]; ok && !policy.RollsOver {
+			continue
+		}
+		if _, ok := index.Metadata.Aliases[alias]; !ok {
+			waitingRollover[alias] = append(waitingRollover[alias], indexName)
+		}
+	}
+
+	if len(policyIndices) > 0 {
+		counts := map[string]int{}
+		managed := 0
+		for policy, indices := range policyIndices {
+			counts[policy] = len(indices)
+			managed += len(indices)
+		}
+		d.Comment(S052_LifecycleSummary, managed, len(d.Indices), lifecycle.System, topCounts(counts, len(counts)))
+	}
+
+	aliases := []string{}
+	for alias := range waitingRollover {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		indices := waitingRollover[alias]
+		d.Comment(
+			W052_RolloverAliasMissing, alias, lifecycle.System, strings.Join(indices, ", "),
+			indices[len(indices)-1], alias,
+		)
+	}
+
+	policies := []string{}
+	for policy := range policyIndices {
+		policies = append(policies, policy)
+	}
+	sort.Strings(policies)
+	for _, name := range policies {
+		// policies missing from the policies list (eg deleted while in use) are not known to never delete
+		if policy, ok := lifecycle.Policies[name]; ok && !policy.Deletes {
+			d.Comment(
+				W053_LifecyclePolicyNeverDeletes, lifecycle.System, name, len(policyIndices[name]),
+				util.HumanizeBytes(policyBytes[name]), phaseName,
+			)
+		}
+	}
+
+	if unmanaged > 0 {
+		d.Comment(
+			A051_UnmanagedTimeSeriesIndices, unmanaged, lifecycle.System,
+			topCounts(unmanagedFamilies, unmanagedFamiliesToShow),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package diagnosis
+
+import (
+	"context"
+	"testing"
+
+	"esdoctor/metadata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeSeriesFamily(t *testing.T) {
+	test := func(name string, expected string, ok bool) {
+		family, isTimeSeries := timeSeriesFamily(name)
+		assert.Equal(t, ok, isTimeSeries, "index %s time series detection", name)
+		assert.Equal(t, expected, family, "index %s family", name)
+	}
+	test("logs-2021.01.31", "logs-*", true)
+	test("logs_2021-01", "logs_*", true)
+	test("metrics-app.2021.01.31.23", "metrics-app.*", true)
+	test("logs-000042", "logs-*", true)
+	test(".ds-logs-app-2021.01.31-000001", ".ds-logs-app-*", true)
+	test("products", "", false)
+	test("products-v2", "", false)
+	test(".kibana-000001", "", false)
+}
+
+func TestProcessLifecycle(t *testing.T) {
+	d := Diagnostics{
+		Cluster: &Cluster{Lifecycle: &metadata.Lifecycle{
+			System: metadata.LifecycleILM,
+			Policies: map[string]*metadata.LifecyclePolicy{
+				"logs":    {Name: "logs", Deletes: true, RollsOver: true},
+				"metrics": {Name: "metrics"},
+			},
+		}},
+		Indices: map[string]*Index{},
+	}
+	addIndex := func(name string, lifecycle *metadata.IndexLifecycle, alias string, aliases ...string) {
+		index := Index{Name: name, Lifecycle: lifecycle, Metadata: &metadata.Index{Aliases: map[string]metadata.Alias{}}}
+		index.Metadata.Settings.Index.Lifecycle.RolloverAlias = alias
+		for _, a := range aliases {
+			index.Metadata.Aliases[a] = metadata.Alias{}
+		}
+		d.Indices[name] = &index
+	}
+	addIndex("logs-000001", &metadata.IndexLifecycle{Policy: "logs", Phase: "hot", Action: "rollover", Step: "check-rollover-ready"}, "logs", "logs")
+	addIndex("logs-000002", &metadata.IndexLifecycle{
+		Policy: "logs", Phase: "hot", Action: "rollover", Step: "ERROR", Failed: true, FailedStep: "check-rollover-ready",
+		Reason: "index.lifecycle.rollover_alias [applogs] does not point to index [logs-000002]",
+	}, "applogs")
+	addIndex("metrics-2021.01.31", &metadata.IndexLifecycle{Policy: "metrics", Phase: "hot", Action: "complete", Step: "complete"}, "")
+	addIndex("events-2021.01.30", nil, "")
+	addIndex("events-2021.01.31", nil, "")
+	addIndex("products", nil, "")
+
+	assert.NoError(t, d.processLifecycle(context.Background()))
+	codes := commentsByCode(&d)
+	assert.Len(t, codes["I051"], 3)
+	assert.Equal(t, []string{"3 of 6 indices are managed by ILM policies: logs (2), metrics (1)"}, codes["S052"])
+	assert.Len(t, codes["W051"], 1)
+	assert.Contains(t, codes["W051"][0], "POST logs-000002/_ilm/retry")
+	assert.Len(t, codes["W052"], 1)
+	assert.Contains(t, codes["W052"][0], "Rollover alias applogs")
+	assert.Len(t, codes["W053"], 1)
+	assert.Contains(t, codes["W053"][0], "ILM policy metrics manages 1 indices")
+	assert.Equal(t, []string{
+		"2 time series indices are not managed by any ILM policy: events-* (2). Without one they need to be " +
+			"rolled over and deleted by hand, or old ones are never removed as new ones are created. Attach a " +
+			"policy to them, eg through the index templates creating them",
+	}, codes["A051"])
+}
@@ -20,13 +20,40 @@ type dataCollection struct {
 	indicesMetadata metadata.Indices
 	clusterState    *metadata.ClusterState
 	clusterHealth   *metadata.ClusterHealth
+	clusterSettings *metadata.ClusterSettings
+	pendingTasks    *metadata.PendingTasks
+	nodesInfo       *metadata.NodesInfo
+	lifecycle       *metadata.Lifecycle
+	snapshots       *metadata.Snapshots
+	indexTemplates  *metadata.IndexTemplates
 	clusterStats    *stats.Cluster
 	indicesStats    *stats.Indices
+	closedStats     *stats.Indices
 	nodesStats      *stats.Nodes
 	tasks           *stats.Tasks
 	hotThreads      *hotthreads.Group
+
+	// first samples of the indices and nodes stats, only when sampling
+	sampledIndicesStats *stats.Indices
+	sampledNodesStats   *stats.Nodes
+	samplingInterval    time.Duration
+
+	allocationExplanations map[shardCopyKey]*metadata.AllocationExplanation
 }
 
+// Identifies a shard copy kind (primary or replica) of a given index shard. Replicas of the same
+// shard share the same key, as the allocation explain api explains them in the same way
+type shardCopyKey struct {
+	index   string
+	shard   int
+	primary bool
+}
+
+// max number of distinct shard copies we ask the allocation explain api about. Clusters in a bad
+// state may have thousands of unassigned shards, which mostly share the same root cause
+// TODO make it configurable
+const maxAllocationExplanations = 100
+
 func (d *Diagnostics) load(ctx context.Context) error {
 	log.Debug("Fetching supporting data")
 
@@ -49,6 +76,42 @@ func (d *Diagnostics) load(ctx context.Context) error {
 		return err
 	}
 
+	if dc.clusterSettings, err = metadata.GetClusterSettings(ctx, d.client); err != nil {
+		return err
+	}
+
+	if dc.pendingTasks, err = metadata.GetPendingTasks(ctx, d.client); err != nil {
+		return err
+	}
+
+	if dc.nodesInfo, err = metadata.GetNodesInfo(ctx, d.client); err != nil {
+		return err
+	}
+
+	// lifecycle management is optional, eg disabled or missing the privileges to use it
+	if dc.lifecycle, err = metadata.GetLifecycle(ctx, d.client, dc.version.OpenSearch()); err != nil {
+		log.Warnf("Failed to fetch index lifecycle management data, skipping its diagnostics: %v", err)
+	}
+
+	// composable templates are missing before Elasticsearch 7.8, which only has legacy templates
+	if dc.indexTemplates, err = metadata.GetIndexTemplates(ctx, d.client); err != nil {
+		log.Warnf("Failed to fetch the composable index templates, only checking legacy templates: %v", err)
+	}
+
+	// listing snapshots can be sorted and limited since Elasticsearch 7.14
+	sortableSnapshots := dc.version.OpenSearch() || dc.version.Major > 7 ||
+		dc.version.Major == 7 && dc.version.Minor >= 14
+	if dc.snapshots, err = metadata.GetSnapshots(ctx, d.client, sortableSnapshots); err != nil {
+		log.Warnf("Failed to fetch the snapshot repositories, skipping snapshot diagnostics: %v", err)
+	} else if !dc.version.OpenSearch() {
+		if dc.snapshots.Policies, err = metadata.GetSnapshotPolicies(ctx, d.client); err != nil {
+			log.Warnf("Failed to fetch the SLM policies, skipping them: %v", err)
+			dc.snapshots.Policies = nil
+		}
+	}
+
+	dc.allocationExplanations = d.loadAllocationExplanations(ctx, dc.clusterState)
+
 	if dc.indicesStats, err = stats.GetIndices(ctx, d.client); err != nil {
 		return err
 	}
@@ -57,6 +120,21 @@ func (d *Diagnostics) load(ctx context.Context) error {
 		return err
 	}
 
+	for _, index := range dc.clusterState.Metadata.Indices {
+		if index.State == metadata.IndexStateClose {
+			if dc.closedStats, err = stats.GetClosedIndices(ctx, d.client); err != nil {
+				log.Warnf("Failed to fetch the stats of closed indices, their disk usage is unknown: %v", err)
+			}
+			break
+		}
+	}
+
+	if d.config.samplingInterval > 0 {
+		if err = d.loadSecondSample(ctx, &dc); err != nil {
+			return err
+		}
+	}
+
 	if dc.clusterStats, err = stats.GetCluster(ctx, d.client); err != nil {
 		return err
 	}
@@ -68,7 +146,7 @@ func (d *Diagnostics) load(ctx context.Context) error {
 	if dc.hotThreads, err = hotthreads.Get(
 		ctx, d.client,
 		hotthreads.WithInterval(1*time.Second),
-		hotthreads.WithTypes(hotthreads.TypeCPU, hotthreads.TypeCPU, hotthreads.TypeWait),
+		hotthreads.WithTypes(hotthreads.TypeCPU, hotthreads.TypeWait),
 	); err != nil {
 		return err
 	}
@@ -80,6 +158,66 @@ func (d *Diagnostics) load(ctx context.Context) error {
 	return nil
 }
 
+// Keeps the already fetched indices and nodes stats as the first sample and fetches them again
+// after the sampling interval
+func (d *Diagnostics) loadSecondSample(ctx context.Context, dc *dataCollection) error {
+	var err error
+	dc.sampledIndicesStats = dc.indicesStats
+	dc.sampledNodesStats = dc.nodesStats
+	sampledAt := time.Now()
+
+	log.Infof("Waiting %v to fetch the second stats sample", d.config.samplingInterval)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d.config.samplingInterval):
+	}
+
+	if dc.indicesStats, err = stats.GetIndices(ctx, d.client); err != nil {
+		return err
+	}
+	// index stats have no timestamp, so we use the time between both requests
+	dc.samplingInterval = time.Since(sampledAt)
+
+	if dc.nodesStats, err = stats.GetNodes(ctx, d.client); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Fetches allocation explanations for all shards that are not in the STARTED state. Failures are
+// not fatal, as shards may change state between fetching the cluster state and explaining them
+func (d *Diagnostics) loadAllocationExplanations(ctx context.Context, state *metadata.ClusterState) map[shardCopyKey]*metadata.AllocationExplanation {
+	result := map[shardCopyKey]*metadata.AllocationExplanation{}
+	for indexName, index := range state.RoutingTable.Indices {
+		for _, shards := range index.Shards {
+			for _, shard := range shards {
+				if shard.State == "STARTED" {
+					continue
+				}
+				key := shardCopyKey{index: indexName, shard: shard.Shard, primary: shard.Primary}
+				if _, ok := result[key]; ok {
+					continue
+				}
+				if len(result) >= maxAllocationExplanations {
+					log.Warnf(
+						"Reached the limit of %d allocation explanations, skipping the remaining shards",
+						maxAllocationExplanations,
+					)
+					return result
+				}
+				explanation, err := metadata.GetAllocationExplanation(ctx, d.client, indexName, shard.Shard, shard.Primary)
+				if err != nil {
+					log.Warnf("Failed to explain allocation of shard %d of %s: %v", shard.Shard, indexName, err)
+					continue
+				}
+				result[key] = explanation
+			}
+		}
+	}
+	return result
+}
+
 func (d *Diagnostics) normalize(c dataCollection) {
 	// version data normalization
 	d.Version = c.version
@@ -89,9 +227,14 @@ func (d *Diagnostics) normalize(c dataCollection) {
 
 	// cluster data normalization
 	d.Cluster = &Cluster{
-		State:  c.clusterState,
-		Stats:  c.clusterStats,
-		Health: c.clusterHealth,
+		State:        c.clusterState,
+		Stats:        c.clusterStats,
+		Health:       c.clusterHealth,
+		Settings:     c.clusterSettings,
+		PendingTasks: c.pendingTasks,
+		Lifecycle:    c.lifecycle,
+		Snapshots:    c.snapshots,
+		Templates:    c.indexTemplates,
 	}
 
 	// nodes data normalization
@@ -100,14 +243,24 @@ func (d *Diagnostics) normalize(c dataCollection) {
 		Master: map[string]*Node{},
 		All:    map[string]*Node{},
 	}
-	for id, stats := range c.nodesStats.Nodes {
-		entry := Node{ID: id, Name: stats.Name, Stats: stats}
+	for id, nodeStats := range c.nodesStats.Nodes {
+		entry := Node{ID: id, Name: nodeStats.Name, Stats: nodeStats}
+		// nodes that joined the cluster after fetching their info have none
+		if info, ok := c.nodesInfo.Nodes[id]; ok {
+			entry.Info = &info
+		}
+		if c.sampledNodesStats != nil {
+			// nodes that joined the cluster between samples have no rates
+			if before, ok := c.sampledNodesStats.Nodes[id]; ok {
+				entry.Rates = stats.NewNodeRates(before, nodeStats)
+			}
+		}
 		d.Nodes.All[id] = &entry
-		for _, role := range stats.Roles {
-			switch role {
-			case "data":
+		for _, role := range nodeStats.Roles {
+			if isDataRole(role) {
 				d.Nodes.Data[id] = &entry
-			case "master":
+			}
+			if isMasterRole(role) {
 				d.Nodes.Master[id] = &entry
 			}
 		}
@@ -116,45 +269,82 @@ func (d *Diagnostics) normalize(c dataCollection) {
 	// indices data normalization
 	d.Indices = map[string]*Index{}
 	for name, meta := range c.indicesMetadata {
-		d.Indices[name] = &Index{
+		entry := Index{
 			Name:     name,
+			State:    metadata.IndexStateOpen,
+			Hidden:   meta.Settings.Index.Hidden == "true",
+			Frozen:   meta.Settings.Index.Frozen == "true",
 			Metadata: meta,
 			Stats:    c.indicesStats.Indices[name],
 		}
+		// indices created after fetching the cluster state are not in it, and open
+		if state, ok := c.clusterState.Metadata.Indices[name]; ok && state.State != "" {
+			entry.State = state.State
+		}
+		if entry.Closed() && c.closedStats != nil {
+			entry.Stats = c.closedStats.Indices[name]
+		}
+		if c.sampledIndicesStats != nil && entry.Stats != nil {
+			// indices created between samples have no rates
+			if before, ok := c.sampledIndicesStats.Indices[name]; ok && before != nil {
+				entry.Rates = stats.NewIndexRates(before, entry.Stats, c.samplingInterval)
+			}
+		}
+		if c.lifecycle != nil {
+			entry.Lifecycle = c.lifecycle.Indices[name]
+		}
+		d.Indices[name] = &entry
 	}
 
 	// shards data normalization + some index and node normalization due to shard locations
 	for indexName, index := range c.clusterState.RoutingTable.Indices {
-		normalizedIndex := d.Indices[indexName]
-		indexStats := c.indicesStats.Indices[indexName]
+		normalizedIndex, ok := d.Indices[indexName]
+		if !ok {
+			// created after fetching the indices metadata
+			continue
+		}
+		// indices created after fetching the stats, and closed indices unless replicated, have none
+		shardsStats := map[string][]stats.Shard{}
+		if normalizedIndex.Stats != nil {
+			shardsStats = normalizedIndex.Stats.Shards
+		}
 		nodesWithIndexMap := map[string]struct{}{}
 		nodesWithIndex := []*Node{}
 		for shardID, shards := range index.Shards {
-			shardsStats := indexStats.Shards[shardID]
+			copiesStats := shardsStats[shardID]
 			for _, shard := range shards {
 				// find the stats for this shard
 				var shardStats *stats.Shard
-				for _, s := range shardsStats {
-					if s.Routing.Node == shard.Node {
-						shardStats = &s
+				for idx := range copiesStats {
+					if shard.Node != "" && copiesStats[idx].Routing.Node == shard.Node {
+						shardStats = &copiesStats[idx]
 					}
 				}
 				// create Shard entry
-				normalizedNode := d.Nodes.Data[shard.Node]
 				normalizedShard := Shard{
 					ID:        shardID,
 					IndexName: indexName,
 					Index:     normalizedIndex,
-					NodeID:    normalizedNode.ID,
-					NodeName:  normalizedNode.Name,
-					Node:      normalizedNode,
 					State:     shard,
 					Stats:     shardStats,
 				}
+				// explanations describe the copies that are not started, not their started siblings
+				if shard.State != "STARTED" {
+					normalizedShard.Allocation = c.allocationExplanations[shardCopyKey{indexName, shard.Shard, shard.Primary}]
+				}
 
 				// create references for this shard in multiple places
 				d.Shards = append(d.Shards, &normalizedShard)
 				normalizedIndex.Shards = append(normalizedIndex.Shards, &normalizedShard)
+
+				// unassigned shards are not present in any node
+				normalizedNode := d.Nodes.Data[shard.Node]
+				if normalizedNode == nil {
+					continue
+				}
+				normalizedShard.NodeID = normalizedNode.ID
+				normalizedShard.NodeName = normalizedNode.Name
+				normalizedShard.Node = normalizedNode
 				normalizedNode.Shards = append(normalizedNode.Shards, &normalizedShard)
 
 				// mark this index being present in this node as it contains at least one shard on it
@@ -172,6 +362,7 @@ func (d *Diagnostics) normalize(c dataCollection) {
 
 	// tasks data recursive normalization
 	for _, task := range c.tasks.Tasks {
+		task := task // normalized tasks keep a reference to it, so it cannot be the loop variable
 		d.Tasks = append(d.Tasks, d.normalizeTask(&task))
 	}
 }
@@ -183,8 +374,8 @@ func (d *Diagnostics) normalizeTask(task *stats.Task) *Task {
 		Node:     d.Nodes.All[task.Node],
 		Children: []*Task{},
 	}
-	for _, child := range task.Children {
-		normalizedChild := d.normalizeTask(&child)
+	for idx := range task.Children {
+		normalizedChild := d.normalizeTask(&task.Children[idx])
 		result.Children = append(result.Children, normalizedChild)
 		normalizedChild.Parent = &result
 	}
@@ -0,0 +1,110 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"esdoctor/math"
+	"esdoctor/metadata"
+)
+
+const I014_IndexMapping = "I014: " +
+	"Index %s mapping has %d fields (limit of %d), a max depth of %d (limit of %d) and %d nested " +
+	"fields (limit of %d). Dynamic mapping is %s"
+
+const W014_IndexMappingNearLimit = "W014: " +
+	"Index %s mapping has %d %s, which is %.1f%% of the %s limit of %d. Once the limit is reached, " +
+	"indexing documents that would add new fields to the mapping fails. %s"
+
+const S014_LargestMappings = "S014: " +
+	"The %d indices with the largest mappings are: %s"
+
+// from which fraction of a mapping limit we warn about it
+// TODO make it configurable
+const mappingLimitWarningFactor float64 = 0.8 // 80%
+
+// how many of the largest mappings are listed
+const largestMappingsToShow = 10
+
+// ES defaults for the index.mapping.*.limit settings, used in case they cannot be read
+const defaultTotalFieldsLimit = 1000
+const defaultDepthLimit = 20
+const defaultNestedFieldsLimit = 50
+
+func (d *Diagnostics) processMappings(ctx context.Context) error {
+	type indexMapping struct {
+		name  string
+		stats metadata.MappingStats
+	}
+	mappings := []indexMapping{}
+
+	for indexName, index := range d.Indices {
+		// closed indices are not written to, and hidden ones have mappings managed by ES itself
+		if index.Closed() || index.Hidden {
+			continue
+		}
+		mapping := index.Metadata.Mappings
+		stats := mapping.Stats()
+		mappings = append(mappings, indexMapping{name: indexName, stats: stats})
+
+		limits := index.Metadata.Settings.Index.Mapping
+		totalFieldsLimit := settingInt(limits.TotalFields.Limit, defaultTotalFieldsLimit)
+		depthLimit := settingInt(limits.Depth.Limit, defaultDepthLimit)
+		nestedFieldsLimit := settingInt(limits.NestedFields.Limit, defaultNestedFieldsLimit)
+		dynamic := mapping.DynamicEnabled()
+
+		dynamicMsg := "disabled"
+		if dynamic {
+			dynamicMsg = "enabled"
+		}
+		d.Comment(
+			I014_IndexMapping, indexName, stats.TotalFields, totalFieldsLimit, stats.MaxDepth, depthLimit,
+			stats.NestedFields, nestedFieldsLimit, dynamicMsg,
+		)
+
+		hint := fmt.Sprintf(
+			"Review if all fields are needed. The limit can be raised with PUT %s/_settings, at the cost "+
+				"of a larger cluster state and higher memory usage", indexName,
+		)
+		if dynamic {
+			hint = "Dynamic mapping is enabled for this index, so new fields are added automatically " +
+				"as documents are indexed, which is a common cause of mapping explosions (eg using " +
+				"ids, dates or other unbounded values as field names). Consider setting \"dynamic\" to " +
+				"false or strict, or mapping free form objects with the flattened field type"
+		}
+		check := func(value int, what string, setting string, limit int) {
+			if limit > 0 && float64(value) >= float64(limit)*mappingLimitWarningFactor {
+				d.Comment(
+					W014_IndexMappingNearLimit, indexName, value, what, math.Pct(value, limit), setting,
+					limit, hint,
+				)
+			}
+		}
+		check(stats.TotalFields, "fields", "index.mapping.total_fields.limit", totalFieldsLimit)
+		check(stats.MaxDepth, "levels of depth", "index.mapping.depth.limit", depthLimit)
+		check(stats.NestedFields, "nested fields", "index.mapping.nested_fields.limit", nestedFieldsLimit)
+	}
+
+	if len(mappings) == 0 {
+		return nil
+	}
+	// reverse sort from largest to smallest mapping
+	sort.Slice(mappings, func(i int, j int) bool {
+		if mappings[i].stats.TotalFields != mappings[j].stats.TotalFields {
+			return mappings[i].stats.TotalFields > mappings[j].stats.TotalFields
+		}
+		return mappings[i].name < mappings[j].name
+	})
+	if len(mappings) > largestMappingsToShow {
+		mappings = mappings[:largestMappingsToShow]
+	}
+	msg := []string{}
+	for _, m := range mappings {
+		msg = append(msg, fmt.Sprintf("%s (%d fields)", m.name, m.stats.TotalFields))
+	}
+	d.Comment(S014_LargestMappings, len(mappings), strings.Join(msg, ", "))
+
+	return nil
+}
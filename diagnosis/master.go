@@ -0,0 +1,122 @@
+package diagnosis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"esdoctor/math"
+)
+
+const I009_NoPendingTasks = "I009: " +
+	"The master node has no cluster state update tasks pending"
+
+const S009_PendingTasks = "S009: " +
+	"The master node has %d cluster state update tasks pending (%d executing), the oldest one waiting " +
+	"in queue for %v. Most common task sources: %s"
+
+const W009_PendingTasksQueue = "W009: " +
+	"The master node has %d cluster state update tasks pending and the oldest one is waiting in queue " +
+	"for %v. A large or old pending tasks queue means the master cannot keep up with cluster state " +
+	"updates (eg index creations, mapping updates, shard state changes), which delays index creation, " +
+	"dynamic mappings and shard recoveries. Check the _cluster/pending_tasks api for details and look " +
+	"for clients creating indices or updating mappings at a high rate. Oldest task: %q (priority %s)"
+
+const W010_ClusterStateQueue = "W010: " +
+	"Node %s has %d cluster states pending to be applied (%d committed, %d in total in its queue). " +
+	"The node is lagging behind the master when applying cluster state updates, which may be caused " +
+	"by long GC pauses, slow disks or an overloaded node. Check the node logs for " +
+	"\"cluster state applier task took\" messages"
+
+const A010_ClusterStateIncompatibleDiffs = "A010: " +
+	"Node %s published %d cluster states as full states and %d as diffs that were incompatible " +
+	"with the state of the receiving nodes, out of %d publications (%.1f%%). Full cluster states are " +
+	"much more expensive to send than diffs and usually happen when nodes miss cluster state " +
+	"updates, for instance due to network issues or nodes frequently leaving and joining the cluster"
+
+// how many pending tasks in the master queue we consider too much
+// TODO make it configurable
+const pendingTasksWarningCount = 50
+
+// how long a task can wait in the master queue before we warn about it
+// TODO make it configurable
+const pendingTaskAgeWarning = 30 * time.Second
+
+// ratio of non-diff cluster state publications from which we advise about it
+const incompatibleDiffsAdviceFactor float64 = 0.1 // 10%
+
+// min number of cluster state publications before we look into how many were not diffs. Nodes
+// joining the cluster always receive a full state, which dominates the numbers on young clusters
+const minPublishedClusterStates = 100
+
+// how many of the most common pending task sources are shown
+const pendingTaskSourcesToShow = 5
+
+func (d *Diagnostics) processPendingTasks(ctx context.Context) error {
+	if d.Cluster.PendingTasks == nil || len(d.Cluster.PendingTasks.Tasks) == 0 {
+		d.Comment(I009_NoPendingTasks)
+		return nil
+	}
+
+	tasks := d.Cluster.PendingTasks.Tasks
+	oldest := tasks[0]
+	executing := 0
+	sources := map[string]int{}
+	for _, task := range tasks {
+		if task.TimeInQueueMillis > oldest.TimeInQueueMillis {
+			oldest = task
+		}
+		if task.Executing {
+			executing++
+		}
+		sources[pendingTaskSourceType(task.Source)]++
+	}
+
+	// the health api also reports the max waiting time, which may be more up to date
+	maxWaiting := time.Duration(oldest.TimeInQueueMillis) * time.Millisecond
+	healthMaxWaiting := time.Duration(d.Cluster.Health.TaskMaxWaitingInQueueMillis) * time.Millisecond
+	if healthMaxWaiting > maxWaiting {
+		maxWaiting = healthMaxWaiting
+	}
+
+	d.Comment(
+		S009_PendingTasks, len(tasks), executing, maxWaiting,
+		topCounts(sources, pendingTaskSourcesToShow),
+	)
+
+	if len(tasks) > pendingTasksWarningCount || maxWaiting > pendingTaskAgeWarning {
+		d.Comment(W009_PendingTasksQueue, len(tasks), maxWaiting, oldest.Source, oldest.Priority)
+	}
+
+	return nil
+}
+
+// Pending task sources carry the task arguments, like in "create-index [foo], cause [api]" or
+// "shard-started StartedShardEntry{...}". We only keep the task type so tasks can be grouped
+func pendingTaskSourceType(source string) string {
+	if idx := strings.IndexAny(source, "[{("); idx > 0 {
+		source = source[:idx]
+	}
+	return strings.TrimSpace(source)
+}
+
+func (d *Diagnostics) processClusterStatePublishing(ctx context.Context) error {
+	for _, node := range d.Nodes.All {
+		discovery := node.Stats.Discovery
+		queue := discovery.ClusterStateQueue
+		if queue.Pending > 0 {
+			d.Comment(W010_ClusterStateQueue, node.Name, queue.Pending, queue.Committed, queue.Total)
+		}
+
+		published := discovery.PublishedClusterStates
+		total := published.FullStates + published.IncompatibleDiffs + published.CompatibleDiffs
+		notDiffs := published.FullStates + published.IncompatibleDiffs
+		if total >= minPublishedClusterStates && float64(notDiffs)/float64(total) > incompatibleDiffsAdviceFactor {
+			d.Comment(
+				A010_ClusterStateIncompatibleDiffs, node.Name, published.FullStates,
+				published.IncompatibleDiffs, total, math.Pct(notDiffs, total),
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"esdoctor/math"
+	"esdoctor/util"
+)
+
+const S015_DeletedDocuments = "S015: " +
+	"The cluster has %d deleted documents out of %d documents (%.1f%%) in primary shards. " +
+	"%d indices have a ratio of deleted documents above their merge policy deletes_pct_allowed"
+
+const W015_IndexDeletedDocuments = "W015: " +
+	"Index %s has %d deleted documents out of %d (%.1f%%) in its primary shards, above the %.1f%% " +
+	"allowed by its index.merge.policy.deletes_pct_allowed setting. Deleted documents still use disk " +
+	"and memory and slow down searches until they are merged away. Shards with the most deleted " +
+	"documents: %s. %s"
+
+const A015_ForceMergeReadOnlyIndex = "A015: " +
+	"Index %s is read-only and has %.1f%% of deleted documents and an average of %.1f segments per " +
+	"primary shard. As no more writes are expected, it can be force merged to %s with POST " +
+	"%s/_forcemerge?max_num_segments=1. Force merging is resource intensive, so prefer to run it " +
+	"outside of peak hours"
+
+const A016_IndexSegmentCount = "A016: " +
+	"Index %s has an average of %.1f segments per primary shard (%d segments in %d primary shards), " +
+	"above %d. Many segments increase search latency and memory usage. %s"
+
+const W016_MergeThrottling = "W016: " +
+	"Index %s merges were throttled for %v out of %v of total merge time (%.1f%%). Heavy merge " +
+	"throttling means merges cannot keep up with the indexing rate, which makes segments (and " +
+	"possibly deleted documents) pile up. Check the indexing rate, the refresh interval and the disk " +
+	"performance of the nodes holding this index"
+
+// ES default for index.merge.policy.deletes_pct_allowed, used in case it cannot be read
+const defaultDeletesPctAllowed float64 = 33.0
+
+// from how many segments per shard (on average) we advise about an index
+// TODO make it configurable
+const segmentsPerShardAdvice float64 = 50
+
+// fraction of the merge time spent throttled from which we warn about an index
+const mergeThrottlingWarningFactor float64 = 0.5 // 50%
+
+// min total merge time for an index before we look into merge throttling
+const mergeThrottlingMinTime = 10 * time.Minute
+
+// how many of the shards with most deleted documents are listed per index
+const deletedDocsShardsToShow = 5
+
+func (d *Diagnostics) processMerges(ctx context.Context) error {
+	var totalDeleted, totalDocs int64
+	indicesAboveDeletesAllowed := 0
+
+	for _, indexName := range d.sortedIndexNames() {
+		index := d.Indices[indexName]
+		if index.Stats == nil || index.Closed() {
+			continue
+		}
+		primaries := index.Stats.Primaries
+		deleted := int64(primaries.Docs.Deleted)
+		docs := int64(primaries.Docs.Count) + deleted
+		totalDeleted += deleted
+		totalDocs += docs
+		deletedPct := 0.0
+		if docs > 0 {
+			deletedPct = math.Pct64(deleted, docs)
+		}
+
+		settings := index.Metadata.Settings.Index
+		readOnly := indexIsReadOnly(index)
+		deletesPctAllowed, err := strconv.ParseFloat(settings.Merge.Policy.DeletesPctAllowed, 64)
+		if err != nil {
+			deletesPctAllowed = defaultDeletesPctAllowed
+		}
+
+		primaryShards := 0
+		type shardDeleted struct {
+			id      string
+			deleted int
+			pct     float64
+		}
+		shards := []shardDeleted{}
+		for _, shard := range index.Shards {
+			if !shard.State.Primary || shard.Stats == nil {
+				continue
+			}
+			primaryShards++
+			shardDocs := shard.Stats.Docs.Count + shard.Stats.Docs.Deleted
+			if shard.Stats.Docs.Deleted > 0 {
+				shards = append(shards, shardDeleted{
+					id:      shard.ID,
+					deleted: shard.Stats.Docs.Deleted,
+					pct:     math.Pct(shard.Stats.Docs.Deleted, shardDocs),
+				})
+			}
+		}
+		segmentsPerShard := 0.0
+		if primaryShards > 0 {
+			segmentsPerShard = float64(primaries.Segments.Count) / float64(primaryShards)
+		}
+
+		if deletedPct > deletesPctAllowed {
+			indicesAboveDeletesAllowed++
+			// reverse sort from most to least deleted documents
+			sort.Slice(shards, func(i int, j int) bool { return shards[i].pct > shards[j].pct })
+			if len(shards) > deletedDocsShardsToShow {
+				shards = shards[:deletedDocsShardsToShow]
+			}
+			shardsMsg := []string{}
+			for _, s := range shards {
+				shardsMsg = append(
+					shardsMsg, fmt.Sprintf("shard %s (%.1f%%, %d docs)", s.id, s.pct, s.deleted),
+				)
+			}
+			hint := "As the index still receives writes, avoid force merging it: force merged segments " +
+				"may grow beyond the max segment size and then are only merged again once they are " +
+				"mostly made of deleted documents. Instead, consider lowering " +
+				"index.merge.policy.deletes_pct_allowed or reviewing the update/delete patterns of " +
+				"the clients writing to it"
+			if readOnly {
+				hint = "Check the force merge advice for this index"
+			}
+			d.Comment(
+				W015_IndexDeletedDocuments, indexName, deleted, docs, deletedPct, deletesPctAllowed,
+				strings.Join(shardsMsg, ", "), hint,
+			)
+		}
+
+		if readOnly && primaryShards > 0 && (deletedPct > deletesPctAllowed || segmentsPerShard > segmentsPerShardAdvice) {
+			benefit := "speed up searches"
+			if reclaimable := int64(float64(primaries.Store.SizeInBytes) * deletedPct / 100.0); reclaimable > 0 {
+				benefit = fmt.Sprintf("reclaim %s of disk and %s", util.HumanizeBytes(reclaimable), benefit)
+			}
+			d.Comment(A015_ForceMergeReadOnlyIndex, indexName, deletedPct, segmentsPerShard, benefit, indexName)
+		}
+
+		if segmentsPerShard > segmentsPerShardAdvice {
+			hint := "This is usually caused by a short refresh interval combined with merges not " +
+				"keeping up with the indexing rate. Check the index.refresh_interval setting and the " +
+				"merge throttling of this index"
+			if readOnly {
+				hint = "Check the force merge advice for this index"
+			}
+			d.Comment(
+				A016_IndexSegmentCount, indexName, segmentsPerShard, primaries.Segments.Count, primaryShards,
+				int(segmentsPerShardAdvice), hint,
+			)
+		}
+
+		merges := index.Stats.Total.Merges
+		mergeTime := time.Duration(merges.TotalTimeInMillis) * time.Millisecond
+		throttled := time.Duration(merges.TotalThrottledTimeInMillis) * time.Millisecond
+		throttledFraction := float64(throttled) / float64(mergeTime)
+		if mergeTime >= mergeThrottlingMinTime && throttledFraction > mergeThrottlingWarningFactor {
+			d.Comment(
+				W016_MergeThrottling, indexName, throttled.Round(time.Second), mergeTime.Round(time.Second),
+				throttledFraction*100.0,
+			)
+		}
+	}
+
+	if totalDocs > 0 {
+		d.Comment(
+			S015_DeletedDocuments, totalDeleted, totalDocs, math.Pct64(totalDeleted, totalDocs),
+			indicesAboveDeletesAllowed,
+		)
+	}
+
+	return nil
+}
+
+// Whether the index has a block preventing writes, in which case no more documents are expected
+// to be written to it. The read_only_allow_delete block is not considered, as it is usually
+// temporarily set by ES when a node reaches the flood stage disk watermark
+func indexIsReadOnly(index *Index) bool {
+	blocks := index.Metadata.Settings.Index.Blocks
+	return blocks.Write == "true" || blocks.ReadOnly == "true"
+}
@@ -0,0 +1,38 @@
+package diagnosis
+
+import (
+	"context"
+	"testing"
+
+	"esdoctor/metadata"
+	"esdoctor/stats"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessMergesForceMergeAdvice(t *testing.T) {
+	test := func(deleted int, segments int, expected string) {
+		index := Index{Name: "logs", Metadata: &metadata.Index{}, Stats: &stats.Index{}}
+		index.Metadata.Settings.Index.Blocks.Write = "true"
+		index.Stats.Primaries.Docs.Count = 100 - deleted
+		index.Stats.Primaries.Docs.Deleted = deleted
+		index.Stats.Primaries.Store.SizeInBytes = 100 * 1024 * 1024
+		index.Stats.Primaries.Segments.Count = segments
+		index.Shards = []*Shard{{ID: "0", State: &metadata.ShardState{Primary: true}, Stats: &stats.Shard{}}}
+		d := Diagnostics{Indices: map[string]*Index{"logs": &index}}
+
+		assert.NoError(t, d.processMerges(context.Background()))
+		codes := commentsByCode(&d)
+		if expected == "" {
+			assert.Empty(t, codes["A015"], "%d%% deleted docs and %d segments", deleted, segments)
+			return
+		}
+		assert.Len(t, codes["A015"], 1, "%d%% deleted docs and %d segments", deleted, segments)
+		assert.Contains(t, codes["A015"][0], expected)
+	}
+
+	test(0, 2, "")
+	test(10, 2, "")
+	test(50, 2, "can be force merged to reclaim 50.0mb of disk and speed up searches with POST")
+	test(0, 60, "can be force merged to speed up searches with POST")
+}
@@ -0,0 +1,158 @@
+package diagnosis
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"esdoctor/metadata"
+)
+
+const I076_AutoExpandReplicas = "I076: " +
+	"Index %s auto-expands its replicas (%s) and currently has %d, with %d data nodes able to hold it"
+
+const S076_ReplicaPlacement = "S076: " +
+	"%d indices auto-expand their replicas, %d are restricted to a subset of the data nodes by data " +
+	"tiers or allocation filters, and %d have shard copies that can never be allocated"
+
+const W076_ReplicasExceedNodes = "W076: " +
+	"Index %s has %d replicas but only %d data nodes can hold its shards (%s), and no two copies of " +
+	"a shard are allocated to the same node. %d replicas of each shard can never be allocated, so " +
+	"the index is permanently yellow. Lower its replicas with PUT %s/_settings " +
+	"{\"index.number_of_replicas\": %d}, or set index.auto_expand_replicas to 0-%d"
+
+const W077_NoEligibleNodes = "W077: " +
+	"No data node can hold the shards of index %s given its %s, so none of them can be allocated. " +
+	"Fix the setting or add nodes matching it"
+
+const W078_TotalShardsPerNodeTooLow = "W078: " +
+	"Index %s has %d shard copies but index.routing.allocation.total_shards_per_node (%d) only " +
+	"lets the %d data nodes able to hold it take %d of them, so the rest can never be allocated. " +
+	"Raise the limit or add nodes"
+
+// Range of replicas from the index.auto_expand_replicas setting, eg 0-1 or 0-all, where max is -1
+// for all. False when auto-expand is disabled
+func autoExpandReplicas(index *Index) (int, int, bool) {
+	setting := index.Metadata.Settings.Index.AutoExpandReplicas
+	parts := strings.SplitN(setting, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false // false or unset
+	}
+	min, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	if parts[1] == "all" {
+		return min, -1, true
+	}
+	max, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return min, max, true
+}
+
+// Whether a node matches any of the comma separated values (possibly with wildcards) of an
+// allocation filter on the given attribute
+func matchesAllocationFilter(node *Node, attribute string, values string) bool {
+	nodeValues := []string{}
+	switch attribute {
+	case "_name":
+		nodeValues = append(nodeValues, node.Name)
+	case "_id":
+		nodeValues = append(nodeValues, node.ID)
+	case "_host", "_ip", "_host_ip", "_publish_ip":
+		if node.Info != nil {
+			nodeValues = append(nodeValues, node.Info.Host, node.Info.IP)
+		}
+	case "_tier":
+		if node.Stats != nil {
+			nodeValues = append(nodeValues, node.Stats.Roles...)
+		}
+	default:
+		if node.Info != nil {
+			if value, ok := node.Info.Attributes[attribute]; ok {
+				nodeValues = append(nodeValues, value)
+			}
+		}
+	}
+	for _, value := range strings.Split(values, ",") {
+		value = strings.TrimSpace(value)
+		for _, nodeValue := range nodeValues {
+			if value != "" && matchesIndexPattern(value, nodeValue) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Data nodes able to hold the shards of an index, given its preferred data tiers and allocation
+// filters. The settings restricting them are described in the second value, empty when none does
+func (d *Diagnostics) eligibleNodes(index *Index) ([]*Node, string) {
+	allocation := index.Metadata.Settings.Index.Routing.Allocation
+	require := metadata.FlatAllocationFilter(allocation.Require)
+	include := metadata.FlatAllocationFilter(allocation.Include)
+	exclude := metadata.FlatAllocationFilter(allocation.Exclude)
+	restrictions := []string{}
+
+	nodes := sortedNodes(d.Nodes.Data)
+	// shards go to the first of the preferred tiers having any node. Nodes with the generic data
+	// role belong to all tiers
+	if preference, ok := include["_tier_preference"]; ok {
+		delete(include, "_tier_preference")
+		restrictions = append(restrictions, "tier preference "+preference)
+		var tierNodes []*Node
+		for _, tier := range strings.Split(preference, ",") {
+			tier = strings.TrimSpace(tier)
+			for _, node := range nodes {
+				if node.Stats != nil && (hasRole(node, tier) || hasRole(node, "data")) {
+					tierNodes = append(tierNodes, node)
+				}
+			}
+			if len(tierNodes) > 0 {
+				break
+			}
+		}
+		nodes = tierNodes
+	}
+	filters := []string{}
+	for _, filter := range []struct {
+		name   string
+		values map[string]string
+	}{{"require", require}, {"include", include}, {"exclude", exclude}} {
+		for attribute, values := range filter.values {
+			filters = append(filters, "index.routing.allocation."+filter.name+"."+attribute+" "+values)
+		}
+	}
+
+	result := []*Node{}
+	for _, node := range nodes {
+		eligible := true
+		for attribute, values := range require {
+			if !matchesAllocationFilter(node, attribute, values) {
+				eligible = false
+			}
+		}
+		if len(include) > 0 {
+			included := false
+			for attribute, values := range include {
+				if matchesAllocationFilter(node, attribute, values) {
+					included = true
+				}
+			}
+			eligible = eligible && included
+		}
+		for attribute, values := range exclude {
+			if matchesAllocationFilter(node, attribute, values) {
+				eligible = false
+			}
+		}
+		if eligible {
+			result = append(result, node)
+		}
+	}
+	sort.Strings(filters)
+	restrictions = append(restrictions, filters...)
+	return result, strings.Join(restrictions, ", ")
+}
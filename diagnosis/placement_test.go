@@ -0,0 +1,86 @@
+package diagnosis
+
+import (
+	"context"
+	"testing"
+
+	"esdoctor/metadata"
+	"esdoctor/stats"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessReplicasPlacement(t *testing.T) {
+	d := Diagnostics{
+		Nodes:   Nodes{Data: map[string]*Node{}, All: map[string]*Node{}},
+		Indices: map[string]*Index{},
+	}
+	addNode := func(name string, role string, attributes map[string]string) {
+		node := Node{
+			ID:    name,
+			Name:  name,
+			Info:  &metadata.NodeInfo{Attributes: attributes},
+			Stats: &stats.Node{Roles: []string{role}},
+		}
+		d.Nodes.Data[name] = &node
+		d.Nodes.All[name] = &node
+	}
+	addNode("hot-1", "data_hot", map[string]string{"box": "ssd"})
+	addNode("hot-2", "data_hot", map[string]string{"box": "hdd"})
+	addNode("warm-1", "data_warm", map[string]string{"box": "hdd"})
+	addIndex := func(name string, shards string, replicas string) *metadata.IndexSettings {
+		index := Index{Name: name, State: metadata.IndexStateOpen, Metadata: &metadata.Index{}}
+		index.Metadata.Settings.Index.NumberOfShards = shards
+		index.Metadata.Settings.Index.NumberOfReplicas = replicas
+		d.Indices[name] = &index
+		return &index.Metadata.Settings.Index
+	}
+	addIndex("kibana", "1", "0").AutoExpandReplicas = "0-1"
+	addIndex("scratch", "1", "0")
+	addIndex("everywhere", "1", "2").AutoExpandReplicas = "0-all"
+	logs := addIndex("logs", "1", "2")
+	logs.Routing.Allocation.Include = map[string]interface{}{"_tier_preference": "data_hot,data_warm"}
+	ssd := addIndex("ssd", "1", "0")
+	ssd.Routing.Allocation.Require = map[string]interface{}{"box": "nvme"}
+	limited := addIndex("limited", "4", "1")
+	limited.Routing.Allocation.TotalShardsPerNode = "2"
+	limited.Routing.Allocation.Exclude = map[string]interface{}{"_name": "warm-*"}
+
+	assert.NoError(t, d.processReplicas(context.Background()))
+	codes := commentsByCode(&d)
+	assert.Len(t, codes["I076"], 2)
+	assert.Len(t, codes["W003"], 2)
+	assert.NotContains(t, codes["W003"][0]+codes["W003"][1], "kibana")
+	assert.Empty(t, codes["A003"])
+	assert.Equal(t, []string{
+		"Index logs has 2 replicas but only 2 data nodes can hold its shards (tier preference " +
+			"data_hot,data_warm), and no two copies of a shard are allocated to the same node. 1 replicas " +
+			"of each shard can never be allocated, so the index is permanently yellow. Lower its replicas " +
+			"with PUT logs/_settings {\"index.number_of_replicas\": 1}, or set index.auto_expand_replicas to 0-1",
+	}, codes["W076"])
+	assert.Equal(t, []string{
+		"No data node can hold the shards of index ssd given its index.routing.allocation.require.box " +
+			"nvme, so none of them can be allocated. Fix the setting or add nodes matching it",
+	}, codes["W077"])
+	assert.Len(t, codes["W078"], 1)
+	assert.Contains(t, codes["W078"][0], "Index limited has 8 shard copies")
+	assert.Equal(t, []string{
+		"2 indices auto-expand their replicas, 3 are restricted to a subset of the data nodes by data " +
+			"tiers or allocation filters, and 3 have shard copies that can never be allocated",
+	}, codes["S076"])
+}
+
+func TestEligibleNodesNestedAttributes(t *testing.T) {
+	d := Diagnostics{Nodes: Nodes{Data: map[string]*Node{
+		"a": {ID: "a", Name: "a", Info: &metadata.NodeInfo{Attributes: map[string]string{"box.type": "hot"}}},
+		"b": {ID: "b", Name: "b", Info: &metadata.NodeInfo{Attributes: map[string]string{"box.type": "cold"}}},
+	}}}
+	index := Index{Name: "logs", Metadata: &metadata.Index{}}
+	index.Metadata.Settings.Index.Routing.Allocation.Require = map[string]interface{}{
+		"box": map[string]interface{}{"type": "h*"},
+	}
+	nodes, restrictions := d.eligibleNodes(&index)
+	assert.Len(t, nodes, 1)
+	assert.Equal(t, "a", nodes[0].Name)
+	assert.Equal(t, "index.routing.allocation.require.box.type h*", restrictions)
+}
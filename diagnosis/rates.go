@@ -0,0 +1,82 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const I023_NodeRates = "I023: " +
+	"Node %s over the last %v: %.1f indexing operations/s, %.1f queries/s, %.1f fetches/s, %.1f " +
+	"rejections/s, %.1fms of GC per second and %.1f io operations/s"
+
+const I024_IndexRates = "I024: " +
+	"Index %s over the last %v: %.1f indexing operations/s, %.1f queries/s and %.1f fetches/s"
+
+const W023_NodeRestartedBetweenSamples = "W023: " +
+	"Node %s restarted between both stats samples, so no rates could be calculated for it. Check the " +
+	"node logs for the reason of the restart"
+
+const W024_OngoingRejections = "W024: " +
+	"Node %s is rejecting %.1f requests per second (%s). Unlike the rejection counters accumulated " +
+	"since the node started, these rejections are happening right now: the thread pool queues are " +
+	"full and clients are getting errors. Reduce the load or the concurrency of the clients, or " +
+	"scale the cluster"
+
+const W025_HighGCTime = "W025: " +
+	"Node %s spent %.0fms per second (%.1f%% of the time) in garbage collection over the last %v. " +
+	"The node is likely under heap pressure: check its heap usage, fielddata and caches, and the " +
+	"size of the requests it serves"
+
+// from which fraction of time spent in GC we warn about it
+// TODO make it configurable
+const gcTimeWarningFraction float64 = 0.1 // 10%
+
+func (d *Diagnostics) processRates(ctx context.Context) error {
+	for _, node := range sortedNodes(d.Nodes.All) {
+		rates := node.Rates
+		if rates == nil {
+			continue
+		}
+		if rates.Restarted {
+			d.Comment(W023_NodeRestartedBetweenSamples, node.Name)
+			continue
+		}
+		d.Comment(
+			I023_NodeRates, node.Name, rates.Interval, rates.IndexingPerSecond, rates.QueriesPerSecond,
+			rates.FetchesPerSecond, rates.RejectionsPerSecond, rates.GCMillisPerSecond, rates.IOOpsPerSecond,
+		)
+
+		if rates.RejectionsPerSecond > 0 {
+			pools := []string{}
+			for pool := range rates.ThreadPoolRejectionsPerSecond {
+				pools = append(pools, pool)
+			}
+			sort.Strings(pools)
+			msg := []string{}
+			for _, pool := range pools {
+				msg = append(msg, fmt.Sprintf("%s: %.1f/s", pool, rates.ThreadPoolRejectionsPerSecond[pool]))
+			}
+			d.Comment(W024_OngoingRejections, node.Name, rates.RejectionsPerSecond, strings.Join(msg, ", "))
+		}
+
+		gcFraction := rates.GCMillisPerSecond / 1000
+		if gcFraction >= gcTimeWarningFraction {
+			d.Comment(W025_HighGCTime, node.Name, rates.GCMillisPerSecond, gcFraction*100, rates.Interval)
+		}
+	}
+
+	for _, indexName := range d.sortedIndexNames() {
+		rates := d.Indices[indexName].Rates
+		if rates == nil || rates.Reset {
+			continue
+		}
+		d.Comment(
+			I024_IndexRates, indexName, rates.Interval, rates.IndexingPerSecond, rates.QueriesPerSecond,
+			rates.FetchesPerSecond,
+		)
+	}
+
+	return nil
+}
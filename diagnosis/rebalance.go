@@ -0,0 +1,256 @@
+package diagnosis
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"esdoctor/math"
+	"esdoctor/metadata"
+	"esdoctor/util"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const A050_RebalancePlan = "A050: " +
+	"Moving %d shard copies (%s in total) brings the disk usage of data nodes %s: POST " +
+	"_cluster/reroute %s. The plan honors the same shard, allocation awareness and allocation " +
+	"filtering constraints and is not executed. Review it before running it, and note that the balancer " +
+	"balances shard counts rather than disk usage, so it may move some shards back"
+
+const W050_NoRebalancePlan = "W050: " +
+	"The disk usage of data nodes is unbalanced, but no shard copy can be moved to balance it without " +
+	"breaking the same shard or allocation awareness constraints, or the disk watermarks. Check for " +
+	"large shards, which are hard to balance, and consider splitting them"
+
+// max number of moves in a rebalance plan, keeping it reviewable
+// TODO make it configurable
+const maxRebalanceMoves = 100
+
+// How far from the median, in percent, the disk usage of data nodes can be while being balanced
+const RebalanceTolerancePercent = int(unbalanceDiskUsageWarningFactor * 100)
+
+// Shard moves balancing the disk usage of data nodes
+type RebalancePlan struct {
+	Commands   metadata.RerouteCommands `json:"commands"`
+	MovedBytes int64                    `json:"moved_bytes"`
+	// median disk usage of the data nodes, around which usage is balanced
+	Median int64 `json:"median"`
+	// whether all data nodes end up within the balance band around the median
+	Balanced bool `json:"balanced"`
+}
+
+func shardSize(shard *Shard) int64 {
+	if shard.Stats == nil {
+		return 0
+	}
+	return shard.Stats.Store.SizeInBytes
+}
+
+// Computes a small set of shard moves bringing the disk usage of every data node within
+// unbalanceDiskUsageWarningFactor of the median. Moves go from the most to the least used nodes,
+// largest shards first, as long as they do not overshoot the balance between both nodes and the
+// receiver is allowed to hold the shard
+func (d *Diagnostics) PlanRebalance() *RebalancePlan {
+	result := RebalancePlan{Commands: metadata.RerouteCommands{Commands: []metadata.RerouteCommand{}}}
+	if len(d.Nodes.Data) < 2 {
+		result.Balanced = true
+		return &result
+	}
+
+	watermark := defaultDiskWatermarkLow
+	if d.Cluster != nil && d.Cluster.Settings != nil {
+		if setting := d.Cluster.Settings.Get("cluster.routing.allocation.disk.watermark.low"); setting != "" {
+			watermark = setting
+		}
+	}
+	attributes := d.awarenessAttributes()
+
+	nodes := sortedNodes(d.Nodes.Data)
+	usage := map[*Node]int64{}
+	headroom := map[*Node]int64{}
+	usages := []int64{}
+	for _, node := range nodes {
+		usage[node] = node.Stats.Fs.Total.TotalInBytes - node.Stats.Fs.Total.AvailableInBytes
+		h, err := nodeDiskHeadroom(node, watermark)
+		if err != nil {
+			log.Errorf("failed to calculate the disk headroom of node %s: %v", node.Name, err)
+		}
+		headroom[node] = h
+	}
+	// the target of an ongoing relocation holds a copy of the shard already, and its bytes soon
+	relocationTarget := func(shard *Shard) *Node {
+		if id, ok := shard.State.RelocatingNode.(string); ok && shard.State.State == "RELOCATING" {
+			return d.Nodes.All[id]
+		}
+		return nil
+	}
+	for _, shard := range d.Shards {
+		if target := relocationTarget(shard); target != nil {
+			if _, ok := usage[target]; ok {
+				usage[target] += shardSize(shard)
+				headroom[target] -= shardSize(shard)
+			}
+		}
+	}
+	for _, node := range nodes {
+		usages = append(usages, usage[node])
+	}
+	result.Median = math.PercentilesInt64(usages, 10)[5]
+	lower := int64(float64(result.Median) * (1.0 - unbalanceDiskUsageWarningFactor))
+	upper := int64(float64(result.Median) * (1.0 + unbalanceDiskUsageWarningFactor))
+
+	// nodes holding copies of each shard, as moves are planned
+	type shardKey struct {
+		index string
+		id    string
+	}
+	copies := map[shardKey][]*Node{}
+	for _, shard := range d.Shards {
+		key := shardKey{shard.IndexName, shard.ID}
+		if shard.Node != nil {
+			copies[key] = append(copies[key], shard.Node)
+		}
+		if target := relocationTarget(shard); target != nil {
+			copies[key] = append(copies[key], target)
+		}
+	}
+	// data nodes the allocation filters and tier preference of each index let hold its shards
+	eligible := map[string]map[*Node]bool{}
+	for name, index := range d.Indices {
+		if index.Metadata == nil {
+			continue
+		}
+		nodes, _ := d.eligibleNodes(index)
+		eligible[name] = map[*Node]bool{}
+		for _, node := range nodes {
+			eligible[name][node] = true
+		}
+	}
+	// whether a copy of the shard can move from one node to another
+	allowed := func(shard *Shard, from *Node, to *Node) bool {
+		if nodes, ok := eligible[shard.IndexName]; ok && !nodes[to] {
+			return false
+		}
+		for _, node := range copies[shardKey{shard.IndexName, shard.ID}] {
+			if node == to {
+				return false
+			}
+			if node == from {
+				continue
+			}
+			for _, attribute := range attributes {
+				if nodeZone(from, attribute) != nodeZone(to, attribute) &&
+					nodeZone(node, attribute) == nodeZone(to, attribute) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	shardsOf := map[*Node][]*Shard{}
+	for _, node := range nodes {
+		for _, shard := range node.Shards {
+			if shard.State.State == "STARTED" && shardSize(shard) > 0 {
+				shardsOf[node] = append(shardsOf[node], shard)
+			}
+		}
+		sort.SliceStable(shardsOf[node], func(i int, j int) bool {
+			return shardSize(shardsOf[node][i]) > shardSize(shardsOf[node][j])
+		})
+	}
+
+	// moves a copy from the donor to the receiver, returning whether any could be moved
+	move := func(donor *Node, receiver *Node) bool {
+		gap := usage[donor] - usage[receiver]
+		for idx, shard := range shardsOf[donor] {
+			size := shardSize(shard)
+			if size > gap/2 || size > headroom[receiver] || !allowed(shard, donor, receiver) {
+				continue
+			}
+			result.Commands.Commands = append(result.Commands.Commands, metadata.RerouteCommand{
+				Move: &metadata.RerouteMove{
+					Index:    shard.IndexName,
+					Shard:    shard.State.Shard,
+					FromNode: donor.Name,
+					ToNode:   receiver.Name,
+				},
+			})
+			result.MovedBytes += size
+			usage[donor] -= size
+			usage[receiver] += size
+			headroom[receiver] -= size
+			key := shardKey{shard.IndexName, shard.ID}
+			for i, node := range copies[key] {
+				if node == donor {
+					copies[key][i] = receiver
+				}
+			}
+			// each copy is moved at most once
+			shardsOf[donor] = append(shardsOf[donor][:idx], shardsOf[donor][idx+1:]...)
+			return true
+		}
+		return false
+	}
+
+	for len(result.Commands.Commands) < maxRebalanceMoves {
+		sort.SliceStable(nodes, func(i int, j int) bool { return usage[nodes[i]] < usage[nodes[j]] })
+		if usage[nodes[len(nodes)-1]] <= upper && usage[nodes[0]] >= lower {
+			break
+		}
+
+		// the most used node may hold no shard fitting anywhere, while the next ones do. Only moves
+		// involving a node outside of the balance band are planned
+		moved := false
+		for i := len(nodes) - 1; i > 0 && !moved; i-- {
+			donor := nodes[i]
+			for _, receiver := range nodes[:i] {
+				if usage[donor] <= upper && usage[receiver] >= lower {
+					continue
+				}
+				if moved = move(donor, receiver); moved {
+					break
+				}
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+
+	result.Balanced = true
+	for _, node := range nodes {
+		if usage[node] < lower || usage[node] > upper {
+			result.Balanced = false
+		}
+	}
+	return &result
+}
+
+func (d *Diagnostics) commentRebalancePlan() {
+	plan := d.PlanRebalance()
+	if len(plan.Commands.Commands) == 0 {
+		if !plan.Balanced {
+			d.Comment(W050_NoRebalancePlan)
+		}
+		return
+	}
+	encoded, err := json.Marshal(plan.Commands)
+	if err != nil {
+		log.Errorf("failed to json encode the rebalance plan: %v", err)
+		return
+	}
+	outcome := fmt.Sprintf(
+		"within %d%% of the median of %s", RebalanceTolerancePercent, util.HumanizeBytes(plan.Median),
+	)
+	if !plan.Balanced {
+		outcome = fmt.Sprintf(
+			"closer to the median of %s, although some nodes remain more than %d%% away from it",
+			util.HumanizeBytes(plan.Median), RebalanceTolerancePercent,
+		)
+	}
+	d.Comment(
+		A050_RebalancePlan, len(plan.Commands.Commands), util.HumanizeBytes(plan.MovedBytes), outcome,
+		string(encoded),
+	)
+}
@@ -0,0 +1,121 @@
+package diagnosis
+
+import (
+	"testing"
+
+	"esdoctor/metadata"
+	"esdoctor/stats"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const gb = 1024 * 1024 * 1024
+
+func addRebalanceNode(d *Diagnostics, id string, used int64, attributes map[string]string) *Node {
+	node := Node{ID: id, Name: id, Info: &metadata.NodeInfo{Attributes: attributes}, Stats: &stats.Node{}}
+	node.Stats.Fs.Total.TotalInBytes = 1000 * gb
+	node.Stats.Fs.Total.AvailableInBytes = 1000*gb - used
+	d.Nodes.Data[id] = &node
+	d.Nodes.All[id] = &node
+	return &node
+}
+
+func addRebalanceShard(d *Diagnostics, index string, id int, node *Node, size int64) *Shard {
+	shard := Shard{
+		ID:        string(rune('0' + id)),
+		IndexName: index,
+		NodeID:    node.ID,
+		NodeName:  node.Name,
+		Node:      node,
+		State:     &metadata.ShardState{State: "STARTED", Shard: id, Node: node.ID},
+		Stats:     &stats.Shard{},
+	}
+	shard.Stats.Store.SizeInBytes = size
+	d.Shards = append(d.Shards, &shard)
+	node.Shards = append(node.Shards, &shard)
+	return &shard
+}
+
+func TestPlanRebalance(t *testing.T) {
+	d := Diagnostics{Nodes: Nodes{Data: map[string]*Node{}, All: map[string]*Node{}}}
+	full := addRebalanceNode(&d, "node-1", 300*gb, nil)
+	other := addRebalanceNode(&d, "node-2", 100*gb, nil)
+	empty := addRebalanceNode(&d, "node-3", 50*gb, nil)
+	// node-3 already holds a copy of logs[0], so it cannot take the one from node-1
+	addRebalanceShard(&d, "logs", 0, full, 80*gb)
+	addRebalanceShard(&d, "logs", 0, empty, 80*gb)
+	addRebalanceShard(&d, "logs", 1, full, 60*gb)
+	addRebalanceShard(&d, "metrics", 0, full, 40*gb)
+	addRebalanceShard(&d, "metrics", 0, other, 40*gb)
+
+	plan := d.PlanRebalance()
+	assert.Equal(t, int64(100*gb), plan.Median)
+	assert.Equal(t, []metadata.RerouteCommand{
+		{Move: &metadata.RerouteMove{Index: "logs", Shard: 1, FromNode: "node-1", ToNode: "node-3"}},
+		{Move: &metadata.RerouteMove{Index: "metrics", Shard: 0, FromNode: "node-1", ToNode: "node-3"}},
+	}, plan.Commands.Commands)
+	assert.Equal(t, int64(100*gb), plan.MovedBytes)
+	// node-1 ends with 200gb, still above the 20% band
+	assert.False(t, plan.Balanced)
+}
+
+func TestPlanRebalanceAwareness(t *testing.T) {
+	d := Diagnostics{
+		Nodes: Nodes{Data: map[string]*Node{}, All: map[string]*Node{}},
+		Cluster: &Cluster{Settings: &metadata.ClusterSettings{Persistent: map[string]interface{}{
+			"cluster.routing.allocation.awareness.attributes": "zone,rack",
+		}}},
+	}
+	full := addRebalanceNode(&d, "a-1", 300*gb, map[string]string{"zone": "a", "rack": "r1"})
+	b1 := addRebalanceNode(&d, "b-1", 100*gb, map[string]string{"zone": "b", "rack": "r3"})
+	addRebalanceNode(&d, "b-2", 50*gb, map[string]string{"zone": "b", "rack": "r2"})
+	c1 := addRebalanceNode(&d, "c-1", 100*gb, map[string]string{"zone": "c", "rack": "r2"})
+	// b-2 would hold both copies of logs[0] in zone b, and both copies of metrics[0] in rack r2
+	addRebalanceShard(&d, "logs", 0, full, 80*gb)
+	addRebalanceShard(&d, "logs", 0, b1, 80*gb)
+	addRebalanceShard(&d, "metrics", 0, full, 40*gb)
+	addRebalanceShard(&d, "metrics", 0, c1, 40*gb)
+	addRebalanceShard(&d, "events", 0, full, 30*gb)
+
+	plan := d.PlanRebalance()
+	assert.Equal(t, []metadata.RerouteCommand{
+		{Move: &metadata.RerouteMove{Index: "events", Shard: 0, FromNode: "a-1", ToNode: "b-2"}},
+		{Move: &metadata.RerouteMove{Index: "metrics", Shard: 0, FromNode: "a-1", ToNode: "b-1"}},
+	}, plan.Commands.Commands)
+}
+
+func TestPlanRebalanceConstraints(t *testing.T) {
+	// node-2 is the target of a relocation of logs[0], whose primary cannot join it
+	d := Diagnostics{Nodes: Nodes{Data: map[string]*Node{}, All: map[string]*Node{}}}
+	full := addRebalanceNode(&d, "node-1", 300*gb, nil)
+	other := addRebalanceNode(&d, "node-2", 0, nil)
+	source := addRebalanceNode(&d, "node-3", 100*gb, nil)
+	addRebalanceShard(&d, "logs", 0, full, 60*gb)
+	relocating := addRebalanceShard(&d, "logs", 0, source, 60*gb)
+	relocating.State.State = "RELOCATING"
+	relocating.State.RelocatingNode = other.ID
+	addRebalanceShard(&d, "metrics", 0, full, 50*gb)
+	plan := d.PlanRebalance()
+	assert.Equal(t, []metadata.RerouteCommand{
+		{Move: &metadata.RerouteMove{Index: "metrics", Shard: 0, FromNode: "node-1", ToNode: "node-2"}},
+	}, plan.Commands.Commands)
+
+	// node-3 is not a hot node, and nothing on node-1 fits elsewhere, but node-2 can still give
+	d = Diagnostics{Nodes: Nodes{Data: map[string]*Node{}, All: map[string]*Node{}}}
+	full = addRebalanceNode(&d, "node-1", 300*gb, nil)
+	other = addRebalanceNode(&d, "node-2", 200*gb, nil)
+	empty := addRebalanceNode(&d, "node-3", 0, nil)
+	full.Stats.Roles = []string{"data_hot"}
+	other.Stats.Roles = []string{"data_hot"}
+	empty.Stats.Roles = []string{"data_warm"}
+	hot := Index{Name: "hot", Metadata: &metadata.Index{}}
+	hot.Metadata.Settings.Index.Routing.Allocation.Include = map[string]interface{}{"_tier_preference": "data_hot"}
+	d.Indices = map[string]*Index{"hot": &hot}
+	addRebalanceShard(&d, "hot", 0, full, 80*gb)
+	addRebalanceShard(&d, "huge", 0, full, 250*gb)
+	addRebalanceShard(&d, "logs", 0, other, 40*gb)
+	plan = d.PlanRebalance()
+	assert.Equal(t, []metadata.RerouteCommand{
+		{Move: &metadata.RerouteMove{Index: "logs", Shard: 0, FromNode: "node-2", ToNode: "node-3"}},
+	}, plan.Commands.Commands)
+}
@@ -0,0 +1,155 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"esdoctor/util"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const I017_IndexRefreshFlushTranslog = "I017: " +
+	"Index %s has a refresh interval of %s, translog durability %s (sync interval of %s) and a flush " +
+	"threshold size of %s. Since nodes started it had %d refreshes (avg of %v each) and %d flushes " +
+	"(avg of %v each), and currently has %s of uncommitted translog"
+
+const A017_WriteHeavyIndexRefresh = "A017: " +
+	"Index %s is write heavy (%d indexing operations against %d search queries since nodes started) " +
+	"and refreshes every %v. Each refresh creates a new segment, so frequent refreshes on a write " +
+	"heavy index generate many small segments to be merged, taking cpu and disk io from indexing. " +
+	"If near real time search is not needed, increase the refresh interval with PUT %s/_settings " +
+	"{\"index.refresh_interval\": \"30s\"}"
+
+const W017_AsyncTranslog = "W017: " +
+	"Index %s has translog durability set to async with a sync interval of %s. Operations are " +
+	"acknowledged before being fsynced to disk, so up to %s of acknowledged writes can be lost if a " +
+	"node crashes. Use PUT %s/_settings {\"index.translog.durability\": \"request\"} unless this data " +
+	"loss is acceptable"
+
+const W018_LargeUncommittedTranslog = "W018: " +
+	"Index %s has shards with large uncommitted translogs, above %.0f times the flush threshold size " +
+	"of %s: %s. Uncommitted operations need to be replayed when the shard recovers, making restarts " +
+	"and relocations slow. Check if flushes are failing in the node logs and for retention leases " +
+	"holding the translog (eg from cross cluster replication)"
+
+const S017_RefreshIntervals = "S017: " +
+	"Refresh intervals across %d indices (with the number of indices using each): %s"
+
+// from which refresh interval (inclusive) we consider it aggressive for a write heavy index
+// TODO make it configurable
+const aggressiveRefreshInterval = 5 * time.Second
+
+// min indexing operations of an index to consider it write heavy
+const writeHeavyMinIndexingOps = 1000000
+
+// how many times the flush threshold size an uncommitted translog needs to be to warn about it
+const uncommittedTranslogWarningFactor float64 = 2
+
+// ES defaults, used in case the settings cannot be read
+const defaultRefreshInterval = "1s"
+const defaultFlushThresholdSize = "512mb"
+
+func (d *Diagnostics) processRefreshFlushTranslog(ctx context.Context) error {
+	intervals := map[string]int{}
+	for _, indexName := range d.sortedIndexNames() {
+		index := d.Indices[indexName]
+		// neither closed nor frozen indices are written to
+		if index.Closed() || index.Frozen {
+			continue
+		}
+		settings := index.Metadata.Settings.Index
+
+		durability := strings.ToLower(settings.Translog.Durability)
+		if durability == "async" {
+			d.Comment(
+				W017_AsyncTranslog, indexName, settings.Translog.SyncInterval, settings.Translog.SyncInterval,
+				indexName,
+			)
+		}
+
+		// settings that fail to parse only skip the checks that need them
+		refreshIntervalSetting := settings.RefreshInterval
+		if refreshIntervalSetting == "" {
+			refreshIntervalSetting = defaultRefreshInterval
+		}
+		intervals[refreshIntervalSetting]++
+		refreshInterval, refreshErr := util.ParseDuration(refreshIntervalSetting)
+		if refreshErr != nil {
+			log.Errorf("failed to read the refresh interval of index %s: %v", indexName, refreshErr)
+		}
+
+		flushThresholdSetting := settings.Translog.FlushThresholdSize
+		if flushThresholdSetting == "" {
+			flushThresholdSetting = defaultFlushThresholdSize
+		}
+		flushThreshold, flushErr := util.ParseBytes(flushThresholdSetting)
+		if flushErr != nil {
+			log.Errorf("failed to read the translog flush threshold size of index %s: %v", indexName, flushErr)
+		}
+
+		if index.Stats == nil {
+			continue
+		}
+		total := index.Stats.Total
+		d.Comment(
+			I017_IndexRefreshFlushTranslog, indexName, refreshIntervalSetting, settings.Translog.Durability,
+			settings.Translog.SyncInterval, flushThresholdSetting, total.Refresh.Total,
+			avgMillis(total.Refresh.TotalTimeInMillis, total.Refresh.Total), total.Flush.Total,
+			avgMillis(total.Flush.TotalTimeInMillis, total.Flush.Total),
+			util.HumanizeBytes(int64(total.Translog.UncommittedSizeInBytes)),
+		)
+
+		indexingOps := total.Indexing.IndexTotal
+		queries := total.Search.QueryTotal
+		writeHeavy := indexingOps >= writeHeavyMinIndexingOps && indexingOps > queries
+		if refreshErr == nil && writeHeavy && refreshInterval > 0 && refreshInterval <= aggressiveRefreshInterval {
+			d.Comment(
+				A017_WriteHeavyIndexRefresh, indexName, indexingOps, queries, refreshInterval, indexName,
+			)
+		}
+
+		if flushErr != nil {
+			continue
+		}
+		largeTranslogs := []string{}
+		for _, shard := range index.Shards {
+			if shard.Stats == nil {
+				continue
+			}
+			uncommitted := int64(shard.Stats.Translog.UncommittedSizeInBytes)
+			if float64(uncommitted) > float64(flushThreshold)*uncommittedTranslogWarningFactor {
+				shardType := "p"
+				if !shard.State.Primary {
+					shardType = "r"
+				}
+				largeTranslogs = append(largeTranslogs, fmt.Sprintf(
+					"shard %s[%s] on %s (%s)", shard.ID, shardType, shard.NodeName,
+					util.HumanizeBytes(uncommitted),
+				))
+			}
+		}
+		if len(largeTranslogs) > 0 {
+			d.Comment(
+				W018_LargeUncommittedTranslog, indexName, uncommittedTranslogWarningFactor,
+				flushThresholdSetting, strings.Join(largeTranslogs, ", "),
+			)
+		}
+	}
+
+	if len(intervals) > 0 {
+		d.Comment(S017_RefreshIntervals, len(d.Indices), topCounts(intervals, len(intervals)))
+	}
+
+	return nil
+}
+
+// average duration of an operation given the total time taken in millis and number of operations
+func avgMillis(totalMillis int, count int) time.Duration {
+	if count == 0 {
+		return 0
+	}
+	return (time.Duration(totalMillis) * time.Millisecond / time.Duration(count)).Round(time.Microsecond)
+}
@@ -0,0 +1,30 @@
+package diagnosis
+
+import (
+	"context"
+	"testing"
+
+	"esdoctor/metadata"
+	"esdoctor/stats"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessRefreshFlushTranslogUnreadableSettings(t *testing.T) {
+	d := Diagnostics{Indices: map[string]*Index{
+		"bad-refresh": {Name: "bad-refresh", Metadata: &metadata.Index{}, Stats: &stats.Index{}},
+		"bad-flush":   {Name: "bad-flush", Metadata: &metadata.Index{}, Stats: &stats.Index{}},
+	}}
+	d.Indices["bad-refresh"].Metadata.Settings.Index.RefreshInterval = "often"
+	d.Indices["bad-flush"].Metadata.Settings.Index.Translog.FlushThresholdSize = "large"
+	for _, index := range d.Indices {
+		index.Metadata.Settings.Index.Translog.Durability = "async"
+		index.Metadata.Settings.Index.Translog.SyncInterval = "5s"
+	}
+
+	assert.NoError(t, d.processRefreshFlushTranslog(context.Background()))
+	codes := commentsByCode(&d)
+	// async durability is reported regardless of the settings that fail to parse
+	assert.Len(t, codes["W017"], 2)
+	assert.Len(t, codes["I017"], 2)
+}
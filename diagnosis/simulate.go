@@ -0,0 +1,274 @@
+package diagnosis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"esdoctor/util"
+)
+
+const S041_SimulationScope = "S041: " +
+	"Simulating the loss of %d node(s): %s. %d data nodes remain, with %s of disk headroom below " +
+	"the low disk watermark (%s)"
+
+const S042_SimulationSafe = "S042: " +
+	"Losing these nodes does not make any index red. %d shard copies (%s) need to be re-replicated, " +
+	"which fits in the disk headroom of the remaining data nodes"
+
+const W041_SimulationRedIndices = "W041: " +
+	"Losing these nodes turns %d indices red, losing all the copies of %d shards (%s of data): %s"
+
+const W042_SimulationYellowIndices = "W042: " +
+	"Losing these nodes turns %d indices yellow until %d shard copies (%s) are re-replicated from " +
+	"the remaining copies: %s"
+
+const W043_SimulationNotEnoughNodes = "W043: " +
+	"%d indices would stay yellow after losing these nodes, as the %d remaining data nodes cannot " +
+	"hold all their copies (each copy of a shard needs a different node): %s"
+
+const W044_SimulationNotEnoughDisk = "W044: " +
+	"The remaining data nodes have %s of disk headroom below the low disk watermark, which is not " +
+	"enough to re-replicate %s of shard copies. Shards would stay unassigned until disk space is " +
+	"freed or nodes are added"
+
+const W045_SimulationLargestShardDoesNotFit = "W045: " +
+	"The largest shard copy to re-replicate (%s, %s) does not fit in any of the remaining data " +
+	"nodes, the largest disk headroom being %s"
+
+const W046_SimulationMasterQuorumLost = "W046: " +
+	"Losing these nodes leaves %d of the %d master eligible nodes, while electing a master needs %d " +
+	"of them. The cluster would be unavailable until enough master eligible nodes return"
+
+// ES default, used in case the setting cannot be read
+const defaultDiskWatermarkLow = "85%"
+
+// Which nodes to simulate losing, by name or by zone
+type Simulation struct {
+	LoseNodes []string
+	LoseZone  string
+	// node attribute holding the zone of the nodes. Defaults to the allocation awareness attribute
+	ZoneAttribute string
+}
+
+// Disk bytes a node can take before reaching the given disk watermark. Watermarks are either
+// ratios of the disk ("85%" or "0.85") or the minimum free disk space ("50gb")
+func nodeDiskHeadroom(node *Node, watermark string) (int64, error) {
+	total := node.Stats.Fs.Total.TotalInBytes
+	available := node.Stats.Fs.Total.AvailableInBytes
+	used := total - available
+
+	var headroom int64
+	watermark = strings.TrimSpace(watermark)
+	if strings.HasSuffix(watermark, "%") {
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(watermark, "%"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid disk watermark %q", watermark)
+		}
+		headroom = int64(float64(total)*pct/100) - used
+	} else if ratio, err := strconv.ParseFloat(watermark, 64); err == nil {
+		headroom = int64(float64(total)*ratio) - used
+	} else {
+		minFree, err := util.ParseBytes(watermark)
+		if err != nil {
+			return 0, fmt.Errorf("invalid disk watermark %q", watermark)
+		}
+		headroom = available - minFree
+	}
+	if headroom < 0 {
+		return 0, nil
+	}
+	return headroom, nil
+}
+
+// Nodes lost in the simulation, by id
+func (d *Diagnostics) simulatedLostNodes(s *Simulation) (map[string]*Node, error) {
+	result := map[string]*Node{}
+	byName := map[string]*Node{}
+	for _, node := range d.Nodes.All {
+		byName[node.Name] = node
+	}
+	for _, name := range s.LoseNodes {
+		node, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("no node named %q in the cluster", name)
+		}
+		result[node.ID] = node
+	}
+	if s.LoseZone != "" {
+		attribute := s.ZoneAttribute
+		if attribute == "" {
+			if attributes := d.awarenessAttributes(); len(attributes) > 0 {
+				attribute = attributes[0]
+			}
+		}
+		if attribute == "" {
+			return nil, errors.New(
+				"cannot tell the zone of the nodes as allocation awareness is not configured, specify the " +
+					"node attribute holding it",
+			)
+		}
+		found := false
+		for _, node := range d.Nodes.All {
+			if nodeZone(node, attribute) == s.LoseZone {
+				result[node.ID] = node
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no node with the %s attribute set to %q in the cluster", attribute, s.LoseZone)
+		}
+	}
+	return result, nil
+}
+
+func (d *Diagnostics) processSimulation(ctx context.Context) error {
+	lost, err := d.simulatedLostNodes(d.config.simulation)
+	if err != nil {
+		return err
+	}
+	lostNames := []string{}
+	for _, node := range sortedNodes(lost) {
+		lostNames = append(lostNames, node.Name)
+	}
+
+	watermark := defaultDiskWatermarkLow
+	if d.Cluster.Settings != nil {
+		if setting := d.Cluster.Settings.Get("cluster.routing.allocation.disk.watermark.low"); setting != "" {
+			watermark = setting
+		}
+	}
+	remainingDataNodes := 0
+	var totalHeadroom, maxHeadroom int64
+	for id, node := range d.Nodes.Data {
+		if _, ok := lost[id]; ok {
+			continue
+		}
+		remainingDataNodes++
+		headroom, err := nodeDiskHeadroom(node, watermark)
+		if err != nil {
+			return err
+		}
+		totalHeadroom += headroom
+		if headroom > maxHeadroom {
+			maxHeadroom = headroom
+		}
+	}
+	d.Comment(
+		S041_SimulationScope, len(lost), strings.Join(lostNames, ", "), remainingDataNodes,
+		util.HumanizeBytes(totalHeadroom), watermark,
+	)
+
+	remainingMasters := 0
+	for id := range d.Nodes.Master {
+		if _, ok := lost[id]; !ok {
+			remainingMasters++
+		}
+	}
+	if quorum := len(d.Nodes.Master)/2 + 1; remainingMasters < quorum {
+		d.Comment(W046_SimulationMasterQuorumLost, remainingMasters, len(d.Nodes.Master), quorum)
+	}
+
+	redIndices, yellowIndices, stuckIndices := []string{}, []string{}, []string{}
+	lostShards, rereplicatedCopies := 0, 0
+	var lostBytes, rereplicatedBytes, largestCopy int64
+	largestCopyName := ""
+	for _, indexName := range d.sortedIndexNames() {
+		index := d.Indices[indexName]
+		type shardCopies struct {
+			size      int64
+			surviving int
+			lost      int
+			total     int
+		}
+		shards := map[string]*shardCopies{}
+		for _, shard := range index.Shards {
+			copies, ok := shards[shard.ID]
+			if !ok {
+				copies = &shardCopies{}
+				shards[shard.ID] = copies
+			}
+			copies.total++
+			if shard.Stats != nil && shard.Stats.Store.SizeInBytes > copies.size {
+				copies.size = shard.Stats.Store.SizeInBytes
+			}
+			// only started copies can be recovered from
+			if shard.Node == nil || shard.State.State != "STARTED" && shard.State.State != "RELOCATING" {
+				continue
+			}
+			if _, ok := lost[shard.NodeID]; ok {
+				copies.lost++
+			} else {
+				copies.surviving++
+			}
+		}
+
+		red, yellow := false, false
+		for id, copies := range shards {
+			if copies.lost == 0 {
+				continue
+			}
+			if copies.surviving == 0 {
+				red = true
+				lostShards++
+				lostBytes += copies.size
+				continue
+			}
+			yellow = true
+			rereplicatedCopies += copies.lost
+			rereplicatedBytes += copies.size * int64(copies.lost)
+			if copies.size > largestCopy {
+				largestCopy = copies.size
+				largestCopyName = fmt.Sprintf("shard %s of %s", id, indexName)
+			}
+		}
+		if red {
+			redIndices = append(redIndices, indexName)
+		} else if yellow {
+			yellowIndices = append(yellowIndices, indexName)
+		}
+		for _, copies := range shards {
+			if (red || yellow) && copies.total > remainingDataNodes {
+				stuckIndices = append(stuckIndices, fmt.Sprintf("%s (%d copies per shard)", indexName, copies.total))
+				break
+			}
+		}
+	}
+	sort.Strings(stuckIndices)
+
+	if len(redIndices) > 0 {
+		d.Comment(
+			W041_SimulationRedIndices, len(redIndices), lostShards, util.HumanizeBytes(lostBytes),
+			strings.Join(redIndices, ", "),
+		)
+	}
+	if len(yellowIndices) > 0 {
+		d.Comment(
+			W042_SimulationYellowIndices, len(yellowIndices), rereplicatedCopies,
+			util.HumanizeBytes(rereplicatedBytes), strings.Join(yellowIndices, ", "),
+		)
+	}
+	if len(stuckIndices) > 0 {
+		d.Comment(W043_SimulationNotEnoughNodes, len(stuckIndices), remainingDataNodes, strings.Join(stuckIndices, ", "))
+	}
+	enoughDisk := rereplicatedBytes <= totalHeadroom
+	if !enoughDisk {
+		d.Comment(
+			W044_SimulationNotEnoughDisk, util.HumanizeBytes(totalHeadroom), util.HumanizeBytes(rereplicatedBytes),
+		)
+	}
+	if largestCopy > maxHeadroom {
+		d.Comment(
+			W045_SimulationLargestShardDoesNotFit, largestCopyName, util.HumanizeBytes(largestCopy),
+			util.HumanizeBytes(maxHeadroom),
+		)
+	}
+	if len(redIndices) == 0 && enoughDisk && largestCopy <= maxHeadroom {
+		d.Comment(S042_SimulationSafe, rereplicatedCopies, util.HumanizeBytes(rereplicatedBytes))
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package diagnosis
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"esdoctor/metadata"
+	"esdoctor/stats"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeDiskHeadroom(t *testing.T) {
+	node := Node{Name: "node-1", Stats: &stats.Node{}}
+	node.Stats.Fs.Total.TotalInBytes = 1000
+	node.Stats.Fs.Total.AvailableInBytes = 400
+
+	test := func(watermark string, expected int64) {
+		got, err := nodeDiskHeadroom(&node, watermark)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, got, "headroom for watermark %q should be %d but got %d instead", watermark, expected, got)
+	}
+	test("85%", 250)
+	test("0.85", 250)
+	test("100b", 300)
+	// already above the watermark
+	test("50%", 0)
+
+	_, err := nodeDiskHeadroom(&node, "foo")
+	assert.Error(t, err)
+}
+
+func TestProcessSimulation(t *testing.T) {
+	// three master eligible data nodes, one per zone, with 1000b disks
+	newDiagnostics := func(available int64, simulation Simulation) *Diagnostics {
+		d := Diagnostics{
+			Cluster: &Cluster{},
+			Indices: map[string]*Index{},
+			Nodes:   Nodes{Data: map[string]*Node{}, Master: map[string]*Node{}, All: map[string]*Node{}},
+			config:  newConfig(WithOutput(nil), WithSimulation(simulation)),
+		}
+		for _, zone := range []string{"a", "b", "c"} {
+			node := Node{
+				ID:    "node-" + zone,
+				Name:  "node-" + zone,
+				Info:  &metadata.NodeInfo{Attributes: map[string]string{"zone": zone}},
+				Stats: &stats.Node{},
+			}
+			node.Stats.Fs.Total.TotalInBytes = 1000
+			node.Stats.Fs.Total.AvailableInBytes = available
+			d.Nodes.Data[node.ID] = &node
+			d.Nodes.Master[node.ID] = &node
+			d.Nodes.All[node.ID] = &node
+		}
+		addIndex := func(name string, size int64, nodes ...string) {
+			index := Index{Name: name}
+			for i, node := range nodes {
+				shard := Shard{
+					ID:     "0",
+					NodeID: node,
+					Node:   d.Nodes.All[node],
+					State:  &metadata.ShardState{State: "STARTED", Primary: i == 0},
+					Stats:  &stats.Shard{},
+				}
+				shard.Stats.Store.SizeInBytes = size
+				index.Shards = append(index.Shards, &shard)
+			}
+			d.Indices[name] = &index
+		}
+		addIndex("scratch", 50, "node-a")
+		addIndex("logs", 100, "node-a", "node-b")
+		addIndex("wide", 100, "node-a", "node-b", "node-c")
+		return &d
+	}
+
+	test := func(name string, available int64, simulation Simulation, expected ...string) {
+		d := newDiagnostics(available, simulation)
+		assert.NoError(t, d.processSimulation(context.Background()), name)
+		codes := []string{}
+		for code := range commentsByCode(d) {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		assert.Equal(t, expected, codes, name)
+	}
+	// wide has more copies than the 2 remaining nodes
+	test("lose node-c", 1000, Simulation{LoseNodes: []string{"node-c"}}, "S041", "S042", "W042", "W043")
+	test("lose zone c", 1000, Simulation{LoseZone: "c", ZoneAttribute: "zone"}, "S041", "S042", "W042", "W043")
+	// scratch has no other copy
+	test("lose node-a", 1000, Simulation{LoseNodes: []string{"node-a"}}, "S041", "W041", "W042", "W043")
+	// 1 of 3 master eligible nodes left, and logs loses both copies
+	test("lose node-a and node-b", 1000, Simulation{LoseNodes: []string{"node-a", "node-b"}}, "S041", "W041", "W042", "W043", "W046")
+	// 10b of headroom per node, for 100b to re-replicate
+	test("no disk", 160, Simulation{LoseNodes: []string{"node-c"}}, "S041", "W042", "W043", "W044", "W045")
+	// 60b of headroom per node, 120b in total, enough for 100b but not in a single node
+	test("no node for the largest shard", 210, Simulation{LoseNodes: []string{"node-c"}}, "S041", "W042", "W043", "W045")
+
+	d := newDiagnostics(1000, Simulation{LoseNodes: []string{"node-a"}})
+	assert.NoError(t, d.processSimulation(context.Background()))
+	codes := commentsByCode(d)
+	assert.Equal(t, []string{"Losing these nodes turns 1 indices red, losing all the copies of 1 shards (50b of data): scratch"}, codes["W041"])
+	assert.Equal(t, []string{
+		"Losing these nodes turns 2 indices yellow until 2 shard copies (200b) are re-replicated from the remaining copies: logs, wide",
+	}, codes["W042"])
+
+	d = newDiagnostics(1000, Simulation{LoseNodes: []string{"node-d"}})
+	assert.Error(t, d.processSimulation(context.Background()))
+}
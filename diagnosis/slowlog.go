@@ -0,0 +1,209 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"esdoctor/metadata"
+	"esdoctor/util"
+)
+
+const I019_IndexSlowlogs = "I019: " +
+	"Index %s slowlog thresholds (warn/info/debug/trace): %s"
+
+const W019_SlowlogDisabledHighLatency = "W019: " +
+	"Index %s has an average %s latency of %v over %d operations since nodes started, but its %s " +
+	"slowlog is disabled. Without the slowlog it is hard to find out which requests are slow. Enable " +
+	"it with PUT %s/_settings {%q: %q}"
+
+const A019_SlowlogThresholdTooLow = "A019: " +
+	"Index %s has the %s slowlog %s threshold set to %s, below %v. Such a low threshold will log " +
+	"a large share of the requests, flooding the slowlog files and adding io overhead to the nodes"
+
+const A020_SlowlogInconsistentTemplate = "A020: " +
+	"The %d indices matching index template %s have inconsistent slowlog configurations: %s. " +
+	"Consider defining the slowlog settings in the template, so all indices get the same configuration"
+
+type slowlogThresholds struct {
+	kind    string
+	setting string // settings prefix of the thresholds, eg index.search.slowlog.threshold.query
+	warn    string
+	info    string
+	debug   string
+	trace   string
+}
+
+func (s slowlogThresholds) levels() map[string]string {
+	return map[string]string{"warn": s.warn, "info": s.info, "debug": s.debug, "trace": s.trace}
+}
+
+// Whether no threshold is enabled. Thresholds are disabled with "-1"
+func (s slowlogThresholds) disabled() bool {
+	for _, value := range s.levels() {
+		if duration, err := util.ParseDuration(value); err == nil && duration >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s slowlogThresholds) String() string {
+	return fmt.Sprintf("%s %s/%s/%s/%s", s.kind, s.warn, s.info, s.debug, s.trace)
+}
+
+func indexSlowlogThresholds(settings *metadata.IndexSettings) []slowlogThresholds {
+	query := settings.Search.Slowlog.Threshold.Query
+	fetch := settings.Search.Slowlog.Threshold.Fetch
+	index := settings.Indexing.Slowlog.Threshold.Index
+	result := []slowlogThresholds{
+		{
+			kind: "search query", setting: "index.search.slowlog.threshold.query",
+			warn: query.Warn, info: query.Info, debug: query.Debug, trace: query.Trace,
+		},
+		{
+			kind: "search fetch", setting: "index.search.slowlog.threshold.fetch",
+			warn: fetch.Warn, info: fetch.Info, debug: fetch.Debug, trace: fetch.Trace,
+		},
+		{
+			kind: "indexing", setting: "index.indexing.slowlog.threshold.index",
+			warn: index.Warn, info: index.Info, debug: index.Debug, trace: index.Trace,
+		},
+	}
+	// UltraWarm indices in AWS have their own slowlog settings
+	warmQuery := settings.Warm.Slowlog.Threshold.Query
+	warmFetch := settings.Warm.Slowlog.Threshold.Fetch
+	if warmQuery.Warn != "" || warmQuery.Info != "" || warmQuery.Debug != "" || warmQuery.Trace != "" {
+		result = append(result, slowlogThresholds{
+			kind: "warm search query", setting: "index.warm.slowlog.threshold.query",
+			warn: warmQuery.Warn, info: warmQuery.Info, debug: warmQuery.Debug, trace: warmQuery.Trace,
+		})
+	}
+	if warmFetch.Warn != "" || warmFetch.Info != "" || warmFetch.Debug != "" || warmFetch.Trace != "" {
+		result = append(result, slowlogThresholds{
+			kind: "warm search fetch", setting: "index.warm.slowlog.threshold.fetch",
+			warn: warmFetch.Warn, info: warmFetch.Info, debug: warmFetch.Debug, trace: warmFetch.Trace,
+		})
+	}
+	return result
+}
+
+// Thresholds below these values log a large share of the requests of the given slowlog kind
+// TODO make it configurable
+var slowlogFloodingThresholds = map[string]time.Duration{
+	"search query":      100 * time.Millisecond,
+	"search fetch":      50 * time.Millisecond,
+	"indexing":          10 * time.Millisecond,
+	"warm search query": 100 * time.Millisecond,
+	"warm search fetch": 50 * time.Millisecond,
+}
+
+// Average latencies above these values are considered high for the given slowlog kind
+// TODO make it configurable
+var slowlogHighLatencies = map[string]time.Duration{
+	"search query": 500 * time.Millisecond,
+	"search fetch": 100 * time.Millisecond,
+	"indexing":     10 * time.Millisecond,
+}
+
+// Thresholds suggested when enabling a disabled slowlog
+var slowlogSuggestedThresholds = map[string]string{
+	"search query": "1s",
+	"search fetch": "500ms",
+	"indexing":     "100ms",
+}
+
+// min number of operations of an index to look into its average latency
+const slowlogMinOperations = 1000
+
+func (d *Diagnostics) processSlowlogs(ctx context.Context) error {
+	// slowlog configuration signatures per template, then the indices using each signature
+	templates := map[string]map[string][]string{}
+	indexTemplates := d.indexTemplates()
+
+	for _, indexName := range d.sortedIndexNames() {
+		index := d.Indices[indexName]
+		thresholds := indexSlowlogThresholds(&index.Metadata.Settings.Index)
+
+		signature := []string{}
+		for _, t := range thresholds {
+			signature = append(signature, t.String())
+		}
+		d.Comment(I019_IndexSlowlogs, indexName, strings.Join(signature, ", "))
+
+		if template := appliedTemplate(indexTemplates, indexName); template != nil {
+			if _, ok := templates[template.name]; !ok {
+				templates[template.name] = map[string][]string{}
+			}
+			key := strings.Join(signature, ", ")
+			templates[template.name][key] = append(templates[template.name][key], indexName)
+		}
+
+		for _, t := range thresholds {
+			floor, ok := slowlogFloodingThresholds[t.kind]
+			if !ok {
+				continue
+			}
+			for _, level := range []string{"warn", "info", "debug", "trace"} {
+				value := t.levels()[level]
+				duration, err := util.ParseDuration(value)
+				if err != nil || duration < 0 || duration >= floor {
+					continue
+				}
+				d.Comment(A019_SlowlogThresholdTooLow, indexName, t.kind, level, value, floor)
+			}
+		}
+
+		// frozen indices are expected to be slow to search
+		if index.Stats == nil || index.Closed() || index.Frozen {
+			continue
+		}
+		total := index.Stats.Total
+		operations := map[string][2]int{
+			"search query": {total.Search.QueryTimeInMillis, total.Search.QueryTotal},
+			"search fetch": {total.Search.FetchTimeInMillis, total.Search.FetchTotal},
+			"indexing":     {total.Indexing.IndexTimeInMillis, total.Indexing.IndexTotal},
+		}
+		for _, t := range thresholds {
+			highLatency, ok := slowlogHighLatencies[t.kind]
+			if !ok || !t.disabled() {
+				continue
+			}
+			timeInMillis, count := operations[t.kind][0], operations[t.kind][1]
+			if count < slowlogMinOperations {
+				continue
+			}
+			avg := avgMillis(timeInMillis, count)
+			if avg > highLatency {
+				d.Comment(
+					W019_SlowlogDisabledHighLatency, indexName, t.kind, avg, count, t.kind, indexName,
+					t.setting+".warn", slowlogSuggestedThresholds[t.kind],
+				)
+			}
+		}
+	}
+
+	templateNames := []string{}
+	for name := range templates {
+		templateNames = append(templateNames, name)
+	}
+	sort.Strings(templateNames)
+	for _, template := range templateNames {
+		signatures := templates[template]
+		if len(signatures) < 2 {
+			continue
+		}
+		total := 0
+		msg := []string{}
+		for signature, indices := range signatures {
+			total += len(indices)
+			msg = append(msg, fmt.Sprintf("%d indices (eg %s) with %s", len(indices), indices[0], signature))
+		}
+		sort.Strings(msg)
+		d.Comment(A020_SlowlogInconsistentTemplate, total, template, strings.Join(msg, "; "))
+	}
+
+	return nil
+}
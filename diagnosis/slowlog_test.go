@@ -0,0 +1,36 @@
+package diagnosis
+
+import (
+	"context"
+	"testing"
+
+	"esdoctor/metadata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessSlowlogsInconsistentTemplate(t *testing.T) {
+	d := Diagnostics{
+		Cluster: &Cluster{
+			State: &metadata.ClusterState{},
+			Templates: &metadata.IndexTemplates{Composable: map[string]metadata.ComposableTemplate{
+				"logs": {IndexPatterns: []string{"logs-*"}, Priority: 100},
+			}},
+		},
+		Indices: map[string]*Index{},
+	}
+	// the legacy template is overridden by the composable one
+	d.Cluster.State.Metadata.Templates = map[string]metadata.Template{
+		"legacy-logs": {IndexPatterns: []string{"logs-*"}},
+	}
+	for name, warn := range map[string]string{"logs-1": "10s", "logs-2": "10s", "logs-3": "5s"} {
+		index := Index{Name: name, Metadata: &metadata.Index{}}
+		index.Metadata.Settings.Index.Search.Slowlog.Threshold.Query.Warn = warn
+		d.Indices[name] = &index
+	}
+
+	assert.NoError(t, d.processSlowlogs(context.Background()))
+	codes := commentsByCode(&d)
+	assert.Len(t, codes["A020"], 1)
+	assert.Contains(t, codes["A020"][0], "The 3 indices matching index template logs have inconsistent slowlog configurations")
+}
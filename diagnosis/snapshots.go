@@ -0,0 +1,223 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"esdoctor/metadata"
+)
+
+const I054_SnapshotRepository = "I054: " +
+	"Snapshot repository %s of type %s holds %d recent snapshots, the latest one being %s (%s, %s ago)"
+
+const S054_Snapshots = "S054: " +
+	"%d snapshot repositories: %s. %s. %d SLM policies"
+
+const W054_NoSnapshotRepository = "W054: " +
+	"No snapshot repository is registered, so the cluster is not backed up. Replicas do not protect " +
+	"against deleted indices, bad writes or losing the whole cluster. Register a repository with PUT " +
+	"_snapshot/<name> and take snapshots regularly (eg with %s)"
+
+const W055_SnapshotRepositoryUnreadable = "W055: " +
+	"Snapshots of repository %s cannot be listed: %s. The repository may be unreachable from the " +
+	"nodes or corrupted. Check it with POST _snapshot/%s/_verify"
+
+const W056_NoSuccessfulSnapshot = "W056: " +
+	"None of the %d snapshot repositories holds a successful snapshot, so the cluster cannot be " +
+	"restored from them"
+
+const W057_SnapshotTooOld = "W057: " +
+	"The last successful snapshot (%s in repository %s) was taken %s ago, more than %s. Data " +
+	"written since then cannot be restored. Check the snapshot schedule and its latest failures"
+
+const W058_FailedSnapshots = "W058: " +
+	"Repository %s has %d failed or partial snapshots since its last successful one: %s. Partial " +
+	"snapshots miss the shards that failed, which cannot be restored from them"
+
+const W059_SnapshotPolicyFailing = "W059: " +
+	"SLM policy %s failed on its last run (snapshot %s, %s ago): %s. Its last success was %s. Check " +
+	"the cause with GET _slm/policy/%s and run it again with POST _slm/policy/%s/_execute"
+
+const W060_IndicesNotSnapshotted = "W060: " +
+	"%d indices holding data are not included in any recent successful snapshot: %s. They cannot " +
+	"be restored if lost. Check the indices the snapshots are configured to include"
+
+const W061_NoReplicasNoSnapshot = "W061: " +
+	"Index %s has no replicas and is not included in any recent successful snapshot. Losing a node " +
+	"holding one of its shards loses that data for good. Add replicas or include it in the snapshots"
+
+// max number of snapshot failures and indices listed in comments
+const snapshotItemsToShow = 10
+
+func millisToTime(millis int64) time.Time {
+	return time.Unix(0, millis*int64(time.Millisecond))
+}
+
+// Indices included in any of the successful snapshots of all repositories. False when snapshots are
+// unknown
+func (d *Diagnostics) snapshottedIndices() (map[string]struct{}, bool) {
+	if d.Cluster == nil || d.Cluster.Snapshots == nil {
+		return nil, false
+	}
+	result := map[string]struct{}{}
+	for _, snapshots := range d.Cluster.Snapshots.Snapshots {
+		for _, snapshot := range snapshots {
+			if snapshot.State != "SUCCESS" {
+				continue
+			}
+			for _, index := range snapshot.Indices {
+				result[index] = struct{}{}
+			}
+		}
+	}
+	return result, true
+}
+
+// Lists up to snapshotItemsToShow items
+func truncatedList(items []string) string {
+	if len(items) > snapshotItemsToShow {
+		items = append(items[:snapshotItemsToShow:snapshotItemsToShow], "...")
+	}
+	return strings.Join(items, ", ")
+}
+
+func (d *Diagnostics) processSnapshots(ctx context.Context) error {
+	if d.Cluster == nil || d.Cluster.Snapshots == nil {
+		return nil
+	}
+	snapshots := d.Cluster.Snapshots
+	now := d.referenceTime()
+
+	if len(snapshots.Repositories) == 0 {
+		scheduler := "SLM"
+		if d.Version.OpenSearch() {
+			scheduler = "snapshot management"
+		}
+		d.Comment(W054_NoSnapshotRepository, scheduler)
+		return nil
+	}
+
+	repositories := []string{}
+	for name := range snapshots.Repositories {
+		repositories = append(repositories, name)
+	}
+	sort.Strings(repositories)
+
+	var lastSuccess *metadata.Snapshot
+	lastSuccessRepository := ""
+	types := map[string]int{}
+	for _, name := range repositories {
+		repository := snapshots.Repositories[name]
+		types[repository.Type]++
+		if reason, ok := snapshots.Errors[name]; ok {
+			d.Comment(W055_SnapshotRepositoryUnreadable, name, reason, name)
+			continue
+		}
+
+		repoSnapshots := snapshots.Snapshots[name]
+		if len(repoSnapshots) > 0 {
+			latest := repoSnapshots[len(repoSnapshots)-1]
+			d.Comment(
+				I054_SnapshotRepository, name, repository.Type, len(repoSnapshots), latest.Snapshot, latest.State,
+				now.Sub(millisToTime(latest.StartTimeInMillis)).Round(time.Minute),
+			)
+		}
+
+		// failed and partial snapshots since the last successful one, latest first
+		failed := []string{}
+		for idx := len(repoSnapshots) - 1; idx >= 0; idx-- {
+			snapshot := &repoSnapshots[idx]
+			if snapshot.State == "SUCCESS" {
+				if lastSuccess == nil || snapshot.StartTimeInMillis > lastSuccess.StartTimeInMillis {
+					lastSuccess = snapshot
+					lastSuccessRepository = name
+				}
+				break
+			}
+			if snapshot.State != "FAILED" && snapshot.State != "PARTIAL" {
+				continue
+			}
+			reason := fmt.Sprintf("%d of %d shards failed", snapshot.Shards.Failed, snapshot.Shards.Total)
+			if len(snapshot.Failures) > 0 {
+				reason = fmt.Sprintf("%s, eg %s", reason, snapshot.Failures[0].Reason)
+			}
+			failed = append(failed, fmt.Sprintf("%s (%s, %s)", snapshot.Snapshot, snapshot.State, reason))
+		}
+		if len(failed) > 0 {
+			d.Comment(W058_FailedSnapshots, name, len(failed), truncatedList(failed))
+		}
+	}
+
+	lastSuccessMsg := "No successful snapshot"
+	if lastSuccess != nil {
+		age := now.Sub(millisToTime(lastSuccess.StartTimeInMillis)).Round(time.Minute)
+		lastSuccessMsg = fmt.Sprintf(
+			"Last successful snapshot %s in repository %s, %s ago", lastSuccess.Snapshot, lastSuccessRepository,
+			age,
+		)
+		if age > d.config.maxSnapshotAge {
+			d.Comment(W057_SnapshotTooOld, lastSuccess.Snapshot, lastSuccessRepository, age, d.config.maxSnapshotAge)
+		}
+	} else if len(snapshots.Errors) < len(snapshots.Repositories) {
+		d.Comment(W056_NoSuccessfulSnapshot, len(snapshots.Repositories))
+	}
+	d.Comment(S054_Snapshots, len(snapshots.Repositories), topCounts(types, len(types)), lastSuccessMsg, len(snapshots.Policies))
+
+	policies := []string{}
+	for name := range snapshots.Policies {
+		policies = append(policies, name)
+	}
+	sort.Strings(policies)
+	for _, name := range policies {
+		policy := snapshots.Policies[name]
+		if policy.LastFailure.Time == 0 || policy.LastFailure.Time < policy.LastSuccess.Time {
+			continue
+		}
+		lastPolicySuccess := "never"
+		if policy.LastSuccess.Time > 0 {
+			lastPolicySuccess = fmt.Sprintf(
+				"%s ago", now.Sub(millisToTime(policy.LastSuccess.Time)).Round(time.Minute),
+			)
+		}
+		d.Comment(
+			W059_SnapshotPolicyFailing, name, policy.LastFailure.SnapshotName,
+			now.Sub(millisToTime(policy.LastFailure.Time)).Round(time.Minute), policy.LastFailure.Details,
+			lastPolicySuccess, name, name,
+		)
+	}
+
+	// indices missing from the snapshots, leaving out the ones created after the last of them and
+	// the indices without replicas, reported along with their replicas
+	if lastSuccess == nil {
+		return nil
+	}
+	snapshotted, _ := d.snapshottedIndices()
+	missing := []string{}
+	for _, indexName := range d.sortedIndexNames() {
+		index := d.Indices[indexName]
+		if _, ok := snapshotted[indexName]; ok || strings.HasPrefix(indexName, ".") {
+			continue
+		}
+		// closed indices cannot be snapshotted
+		if index.Stats == nil || index.Stats.Primaries.Docs.Count == 0 || index.Closed() {
+			continue
+		}
+		settings := index.Metadata.Settings.Index
+		if settingInt(settings.NumberOfReplicas, 1) == 0 {
+			continue
+		}
+		if created, err := strconv.ParseInt(settings.CreationDate, 10, 64); err == nil && created >= lastSuccess.StartTimeInMillis {
+			continue
+		}
+		missing = append(missing, indexName)
+	}
+	if len(missing) > 0 {
+		d.Comment(W060_IndicesNotSnapshotted, len(missing), truncatedList(missing))
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package diagnosis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"esdoctor/metadata"
+	"esdoctor/stats"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessSnapshots(t *testing.T) {
+	now := time.Date(2021, 2, 1, 12, 0, 0, 0, time.UTC)
+	millis := func(ago time.Duration) int64 {
+		return now.Add(-ago).UnixNano() / int64(time.Millisecond)
+	}
+	node := Node{ID: "node-1", Name: "node-1", Stats: &stats.Node{Timestamp: millis(0)}}
+	d := Diagnostics{
+		Cluster: &Cluster{Snapshots: &metadata.Snapshots{
+			Repositories: map[string]metadata.Repository{"backups": {Type: "s3"}, "broken": {Type: "fs"}},
+			Snapshots: map[string][]metadata.Snapshot{"backups": {
+				{Snapshot: "daily-1", State: "SUCCESS", Indices: []string{"logs"}, StartTimeInMillis: millis(72 * time.Hour)},
+				{Snapshot: "daily-2", State: "PARTIAL", Indices: []string{"logs"}, StartTimeInMillis: millis(48 * time.Hour)},
+				{Snapshot: "daily-3", State: "FAILED", StartTimeInMillis: millis(24 * time.Hour)},
+			}},
+			Errors: map[string]string{"broken": "failed to fetch _snapshot/broken/_all, got status code 500 from ES"},
+		}},
+		Nodes:   Nodes{All: map[string]*Node{"node-1": &node}},
+		Indices: map[string]*Index{},
+		config:  newConfig(WithOutput(nil)),
+	}
+	addIndex := func(name string, docs int, replicas string) {
+		index := Index{Name: name, Metadata: &metadata.Index{}, Stats: &stats.Index{}}
+		index.Stats.Primaries.Docs.Count = docs
+		index.Metadata.Settings.Index.NumberOfReplicas = replicas
+		index.Metadata.Settings.Index.CreationDate = "0"
+		d.Indices[name] = &index
+	}
+	addIndex("logs", 10, "1")
+	addIndex("metrics", 10, "1")
+	addIndex("empty", 0, "1")
+	addIndex("scratch", 10, "0")
+	addIndex(".kibana", 10, "1")
+
+	assert.NoError(t, d.processSnapshots(context.Background()))
+	codes := commentsByCode(&d)
+	assert.Len(t, codes["W055"], 1)
+	assert.Contains(t, codes["W055"][0], "repository broken")
+	assert.Equal(t, []string{
+		"Repository backups has 2 failed or partial snapshots since its last successful one: daily-3 " +
+			"(FAILED, 0 of 0 shards failed), daily-2 (PARTIAL, 0 of 0 shards failed). Partial snapshots miss " +
+			"the shards that failed, which cannot be restored from them",
+	}, codes["W058"])
+	assert.Len(t, codes["W057"], 1)
+	assert.Contains(t, codes["W057"][0], "was taken 72h0m0s ago, more than 24h0m0s")
+	assert.Empty(t, codes["W056"])
+	// scratch has no replicas, so it is reported along with them
+	assert.Equal(t, []string{
+		"1 indices holding data are not included in any recent successful snapshot: metrics. They cannot be " +
+			"restored if lost. Check the indices the snapshots are configured to include",
+	}, codes["W060"])
+
+	d.Cluster.Snapshots = &metadata.Snapshots{Repositories: map[string]metadata.Repository{}}
+	d.comments = nil
+	assert.NoError(t, d.processSnapshots(context.Background()))
+	assert.Len(t, d.Comments(), 1)
+	assert.Equal(t, "W054", d.Comments()[0].Code)
+}
@@ -0,0 +1,155 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"esdoctor/util"
+)
+
+const S074_StaleIndices = "S074: " +
+	"%d empty, %d idle and %d expired indices, deleting them would reclaim %s of disk and %d shard copies"
+
+const W074_EmptyIndices = "W074: " +
+	"%d indices have no documents: %s. Each of their %d shard copies still takes heap and cluster " +
+	"state, and counts towards the shards per node limit. Delete the ones not expected to receive data"
+
+const A074_IdleIndices = "A074: " +
+	"%d indices (%s) have received neither writes nor searches since their shards started: %s. " +
+	"Counters reset when nodes restart or shards relocate, so check they are really unused, and " +
+	"delete them or snapshot them first in case they are needed again"
+
+const A075_ExpiredIndices = "A075: " +
+	"%d time series indices (%s) were created more than %d days ago, the configured retention: %s. " +
+	"Delete them, ideally through a lifecycle policy so they do not pile up again"
+
+// max number of indices listed in W074, A074 and A075
+const staleIndicesToShow = 10
+
+// Indices being written to: the write indices of aliases and data streams. Empty and idle indices
+// are expected among them, as they are created ahead of the data
+func (d *Diagnostics) writeIndices() map[string]struct{} {
+	result := map[string]struct{}{}
+	for _, alias := range d.aliases() {
+		if alias.writeIndex != "" {
+			result[alias.writeIndex] = struct{}{}
+		}
+	}
+	if d.Cluster != nil && d.Cluster.State != nil {
+		for _, stream := range d.Cluster.State.Metadata.DataStream.DataStreams {
+			if len(stream.Indices) > 0 {
+				result[stream.Indices[len(stream.Indices)-1].IndexName] = struct{}{}
+			}
+		}
+	}
+	return result
+}
+
+// When the index was created, false when unknown
+func indexCreationTime(index *Index) (time.Time, bool) {
+	if index.Metadata == nil {
+		return time.Time{}, false
+	}
+	created, err := strconv.ParseInt(index.Metadata.Settings.Index.CreationDate, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return millisToTime(created), true
+}
+
+func (d *Diagnostics) processStaleIndices(ctx context.Context) error {
+	writeIndices := d.writeIndices()
+	now := d.referenceTime()
+
+	empty, idle, expired := []*Index{}, []*Index{}, []*Index{}
+	emptyShards := 0
+	var idleBytes, expiredBytes int64
+	// indices to delete, each counted once even if stale for several reasons
+	reclaimable := map[*Index]struct{}{}
+	for _, indexName := range d.sortedIndexNames() {
+		index := d.Indices[indexName]
+		if index.Closed() || index.Hidden || strings.HasPrefix(indexName, ".") || index.Stats == nil {
+			continue // closed indices are covered by W071, system ones are not ours to delete
+		}
+		if _, ok := writeIndices[indexName]; ok {
+			continue
+		}
+		total := index.Stats.Total
+		if total.Docs.Count == 0 {
+			empty = append(empty, index)
+			emptyShards += len(index.Shards)
+			reclaimable[index] = struct{}{}
+		} else if total.Indexing.IndexTotal == 0 && total.Search.QueryTotal == 0 && !index.Frozen {
+			// unsearched frozen indices are covered by A072
+			idle = append(idle, index)
+			idleBytes += total.Store.SizeInBytes
+			reclaimable[index] = struct{}{}
+		}
+
+		if d.config.retention == 0 {
+			continue
+		}
+		if _, ok := timeSeriesFamily(indexName); !ok {
+			continue
+		}
+		// already deleted in due time by its lifecycle policy
+		if index.Lifecycle != nil && d.Cluster != nil && d.Cluster.Lifecycle != nil {
+			if policy, ok := d.Cluster.Lifecycle.Policies[index.Lifecycle.Policy]; ok && policy.Deletes {
+				continue
+			}
+		}
+		if created, ok := indexCreationTime(index); ok && now.Sub(created) > d.config.retention {
+			expired = append(expired, index)
+			expiredBytes += total.Store.SizeInBytes
+			reclaimable[index] = struct{}{}
+		}
+	}
+	if len(reclaimable) == 0 {
+		return nil
+	}
+
+	// largest first
+	formatIndices := func(indices []*Index) string {
+		sort.SliceStable(indices, func(i int, j int) bool {
+			return indexStoreSize(indices[i]) > indexStoreSize(indices[j])
+		})
+		msg := []string{}
+		for _, index := range indices {
+			msg = append(msg, fmt.Sprintf("%s (%s)", index.Name, util.HumanizeBytes(indexStoreSize(index))))
+		}
+		if len(msg) > staleIndicesToShow {
+			msg = append(msg[:staleIndicesToShow], "...")
+		}
+		return strings.Join(msg, ", ")
+	}
+
+	if len(empty) > 0 {
+		d.Comment(W074_EmptyIndices, len(empty), formatIndices(empty), emptyShards)
+	}
+	if len(idle) > 0 {
+		d.Comment(A074_IdleIndices, len(idle), util.HumanizeBytes(idleBytes), formatIndices(idle))
+	}
+	if len(expired) > 0 {
+		d.Comment(
+			A075_ExpiredIndices, len(expired), util.HumanizeBytes(expiredBytes),
+			int(d.config.retention/(24*time.Hour)), formatIndices(expired),
+		)
+	}
+
+	var reclaimableBytes int64
+	reclaimableShards := 0
+	for index := range reclaimable {
+		reclaimableBytes += indexStoreSize(index)
+		reclaimableShards += len(index.Shards)
+	}
+	d.Comment(
+		S074_StaleIndices, len(empty), len(idle), len(expired), util.HumanizeBytes(reclaimableBytes),
+		reclaimableShards,
+	)
+
+	return nil
+}
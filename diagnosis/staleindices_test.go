@@ -0,0 +1,65 @@
+package diagnosis
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"esdoctor/metadata"
+	"esdoctor/stats"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessStaleIndices(t *testing.T) {
+	// epoch millis, as in the node stats and the index creation date
+	const day = int64(24 * time.Hour / time.Millisecond)
+	now := time.Date(2021, 2, 1, 12, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+	node := Node{ID: "node-1", Name: "node-1", Stats: &stats.Node{Timestamp: now}}
+	d := Diagnostics{
+		Cluster: &Cluster{Lifecycle: &metadata.Lifecycle{Policies: map[string]*metadata.LifecyclePolicy{
+			"metrics": {Name: "metrics", Deletes: true},
+		}}},
+		Nodes:   Nodes{All: map[string]*Node{"node-1": &node}},
+		Indices: map[string]*Index{},
+		config:  newConfig(WithOutput(nil), WithRetention(30*24*time.Hour)),
+	}
+	isWriteIndex := true
+	addIndex := func(name string, days int64, docs int, writes int, searches int) *Index {
+		index := Index{
+			Name:     name,
+			State:    metadata.IndexStateOpen,
+			Metadata: &metadata.Index{Aliases: map[string]metadata.Alias{}},
+			Stats:    &stats.Index{},
+			Shards:   []*Shard{{}, {}},
+		}
+		index.Metadata.Settings.Index.CreationDate = strconv.FormatInt(now-days*day, 10)
+		index.Stats.Total.Docs.Count = docs
+		index.Stats.Total.Store.SizeInBytes = int64(docs) * 1024 * 1024
+		index.Stats.Total.Indexing.IndexTotal = writes
+		index.Stats.Total.Search.QueryTotal = searches
+		d.Indices[name] = &index
+		return &index
+	}
+	addIndex("logs-2020.11.01", 90, 100, 0, 5)
+	addIndex("logs-2021.01.31", 1, 50, 10, 5)
+	addIndex("logs-2021.02.01", 0, 0, 0, 0).Metadata.Aliases["logs"] = metadata.Alias{IsWriteIndex: &isWriteIndex}
+	addIndex("scratch", 1, 0, 0, 0)
+	addIndex("products", 90, 10, 0, 0)
+	// its policy deletes it
+	addIndex("metrics-2020.11.01", 90, 10, 5, 0).Lifecycle = &metadata.IndexLifecycle{Policy: "metrics"}
+	addIndex(".kibana", 90, 0, 0, 0)
+
+	assert.NoError(t, d.processStaleIndices(context.Background()))
+	codes := commentsByCode(&d)
+	assert.Len(t, codes["W074"], 1)
+	assert.Contains(t, codes["W074"][0], "1 indices have no documents: scratch (0b). Each of their 2 shard copies")
+	assert.Len(t, codes["A074"], 1)
+	assert.Contains(t, codes["A074"][0], "1 indices (10.0mb) have received neither writes nor searches since their shards started: products (10.0mb)")
+	assert.Len(t, codes["A075"], 1)
+	assert.Contains(t, codes["A075"][0], "1 time series indices (100.0mb) were created more than 30 days ago, the configured retention: logs-2020.11.01 (100.0mb)")
+	assert.Equal(t, []string{
+		"1 empty, 1 idle and 1 expired indices, deleting them would reclaim 110.0mb of disk and 6 shard copies",
+	}, codes["S074"])
+}
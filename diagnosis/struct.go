@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"sync"
+	"time"
 
 	"esdoctor/client"
 	"esdoctor/hotthreads"
@@ -24,13 +25,57 @@ func WithOutput(w CommentWriter) Option {
 	}
 }
 
+// Fetches nodes and indices stats twice, waiting the given interval between both samples, so per
+// second rates can be calculated instead of relying on counters accumulated since nodes started
+func WithSamplingInterval(interval time.Duration) Option {
+	return func(c *config) {
+		c.samplingInterval = interval
+	}
+}
+
+// Instead of running diagnostics, simulates losing the given nodes
+func WithSimulation(s Simulation) Option {
+	return func(c *config) {
+		c.simulation = &s
+	}
+}
+
+// How far into the future capacity planning projects growth
+func WithPlanningHorizon(horizon time.Duration) Option {
+	return func(c *config) {
+		c.planningHorizon = horizon
+	}
+}
+
+// How old the last successful snapshot can be before warning about it
+func WithMaxSnapshotAge(age time.Duration) Option {
+	return func(c *config) {
+		c.maxSnapshotAge = age
+	}
+}
+
+// How long time series indices are kept before advising to delete them. Disabled when 0
+func WithRetention(retention time.Duration) Option {
+	return func(c *config) {
+		c.retention = retention
+	}
+}
+
 type config struct {
-	writer CommentWriter
+	writer           CommentWriter
+	samplingInterval time.Duration // no sampling when 0
+	simulation       *Simulation
+	planningHorizon  time.Duration
+	maxSnapshotAge   time.Duration
+	retention        time.Duration // no retention check when 0
 }
 
 func newConfig(optionFns ...Option) config {
 	config := config{
-		writer: NewTextCommentWriter(os.Stdout, nil, false),
+		writer:          NewTextCommentWriter(os.Stdout, nil, false),
+		planningHorizon: 90 * 24 * time.Hour,
+		maxSnapshotAge:  24 * time.Hour,
+		retention:       90 * 24 * time.Hour,
 	}
 	for _, fn := range optionFns {
 		fn(&config)
@@ -55,9 +100,14 @@ type Diagnostics struct {
 }
 
 type Cluster struct {
-	State  *metadata.ClusterState  `json:"state"`
-	Stats  *stats.Cluster          `json:"stats"`
-	Health *metadata.ClusterHealth `json:"health"`
+	State        *metadata.ClusterState    `json:"state"`
+	Stats        *stats.Cluster            `json:"stats"`
+	Health       *metadata.ClusterHealth   `json:"health"`
+	Settings     *metadata.ClusterSettings `json:"settings"`
+	PendingTasks *metadata.PendingTasks    `json:"pending_tasks"`
+	Lifecycle    *metadata.Lifecycle       `json:"lifecycle,omitempty"` // only when ILM or ISM is available
+	Snapshots    *metadata.Snapshots       `json:"snapshots,omitempty"`
+	Templates    *metadata.IndexTemplates  `json:"templates,omitempty"` // composable, legacy ones are in the state
 }
 
 type Nodes struct {
@@ -67,29 +117,43 @@ type Nodes struct {
 }
 
 type Node struct {
-	ID     string      `json:"id"`
-	Name   string      `json:"name"`
-	Stats  *stats.Node `json:"stats"`
-	Shards []*Shard    `json:"shards"`
+	ID     string             `json:"id"`
+	Name   string             `json:"name"`
+	Info   *metadata.NodeInfo `json:"info"`
+	Stats  *stats.Node        `json:"stats"`
+	Rates  *stats.NodeRates   `json:"rates,omitempty"` // only when sampling
+	Shards []*Shard           `json:"shards"`
 }
 
 type Shard struct {
-	ID        string               `json:"id"`
-	IndexName string               `json:"index"`
-	Index     *Index               `json:"-"` // backlink, avoid cyclic serialization
-	NodeID    string               `json:"node_id"`
-	NodeName  string               `json:"node_name"`
-	Node      *Node                `json:"-"` // backlink, avoid cyclic serialization
-	State     *metadata.ShardState `json:"state"`
-	Stats     *stats.Shard         `json:"stats"`
+	ID         string                          `json:"id"`
+	IndexName  string                          `json:"index"`
+	Index      *Index                          `json:"-"` // backlink, avoid cyclic serialization
+	NodeID     string                          `json:"node_id"`
+	NodeName   string                          `json:"node_name"`
+	Node       *Node                           `json:"-"` // backlink, avoid cyclic serialization
+	State      *metadata.ShardState            `json:"state"`
+	Stats      *stats.Shard                    `json:"stats"`
+	Allocation *metadata.AllocationExplanation `json:"allocation,omitempty"` // only for non STARTED shards
 }
 
 type Index struct {
-	Name     string          `json:"name"`
-	Stats    *stats.Index    `json:"stats"`
-	Metadata *metadata.Index `json:"metadata"`
-	Nodes    []*Node         `json:"-"` // backlink, avoid cyclic serialization
-	Shards   []*Shard        `json:"shards"`
+	Name      string                   `json:"name"`
+	State     string                   `json:"state"`  // open or close, as in the cluster state
+	Hidden    bool                     `json:"hidden"` // left out of wildcard expressions, mostly used by ES itself
+	Frozen    bool                     `json:"frozen"` // searched throttled, loading its data on each search
+	Stats     *stats.Index             `json:"stats"`
+	Rates     *stats.IndexRates        `json:"rates,omitempty"`     // only when sampling
+	Lifecycle *metadata.IndexLifecycle `json:"lifecycle,omitempty"` // only for managed indices
+	Metadata  *metadata.Index          `json:"metadata"`
+	Nodes     []*Node                  `json:"-"` // backlink, avoid cyclic serialization
+	Shards    []*Shard                 `json:"shards"`
+}
+
+// Whether the index is closed. Closed indices can be neither searched nor written to, and only
+// have stats about their store and docs
+func (i *Index) Closed() bool {
+	return i.State == metadata.IndexStateClose
 }
 
 type Task struct {
@@ -115,6 +179,46 @@ func (d *Diagnostics) SpewDump(writer io.Writer) {
 	spew.Fdump(writer, &result)
 }
 
+// Loads diagnostics previously dumped with JSONDump, including their comments. Backlinks between
+// nodes, indices and shards are not restored
+func LoadJSONDump(reader io.Reader) (*Diagnostics, error) {
+	wrapped := struct {
+		*Diagnostics
+		Comments []Comment `json:"comments"`
+	}{
+		Diagnostics: &Diagnostics{},
+	}
+	if err := json.NewDecoder(reader).Decode(&wrapped); err != nil {
+		return nil, err
+	}
+	wrapped.Diagnostics.comments = wrapped.Comments
+	return wrapped.Diagnostics, nil
+}
+
+// When the supporting data was collected, as given by the latest nodes stats timestamp. Zero when
+// unknown
+func (d *Diagnostics) CollectedAt() time.Time {
+	var latest int64
+	for _, node := range d.Nodes.All {
+		if node.Stats != nil && node.Stats.Timestamp > latest {
+			latest = node.Stats.Timestamp
+		}
+	}
+	if latest == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, latest*int64(time.Millisecond))
+}
+
+// Reference time for ages, eg of snapshots or indices: when the supporting data was collected, or
+// now when unknown
+func (d *Diagnostics) referenceTime() time.Time {
+	if collectedAt := d.CollectedAt(); !collectedAt.IsZero() {
+		return collectedAt
+	}
+	return time.Now()
+}
+
 func (d *Diagnostics) JSONDump(writer io.Writer) error {
 	wrapped := struct {
 		*Diagnostics
@@ -0,0 +1,147 @@
+package diagnosis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"esdoctor/math"
+)
+
+const S011_Tasks = "S011: " +
+	"There are %d tasks running in the cluster, %d of them top level tasks. Most common actions: %s"
+
+const W011_LongRunningTask = "W011: " +
+	"Task %s (%s) on node %s has been running for %v, which is longer than the %v threshold for " +
+	"this kind of task. Description: %q. If this task is not expected to run for this long, it can " +
+	"be cancelled with POST _tasks/%s/_cancel"
+
+const W012_LongRunningNonCancellableTask = "W012: " +
+	"Task %s (%s) on node %s has been running for %v, which is longer than the %v threshold for " +
+	"this kind of task, and it is not cancellable. Description: %q. Check the task details with " +
+	"GET _tasks/%s and the logs of node %s, as it may be stuck"
+
+const A011_NodeConcentratingTasks = "A011: " +
+	"Node %s is running %d tasks, %.1f times the median of %d tasks per node. Most common actions " +
+	"on it: %s. Check if clients are sending requests to this node only instead of spreading them " +
+	"across the cluster, or if it holds shards of the indices being heavily used"
+
+type taskThreshold struct {
+	actionPrefix string
+	threshold    time.Duration
+}
+
+// Per action thresholds of how long a task may run before we warn about it. The first matching
+// prefix wins, so more specific prefixes need to come first. Actions not listed here are not
+// checked, as some of them are expected to run for as long as the cluster (eg persistent tasks)
+// TODO make it configurable
+var taskThresholds = []taskThreshold{
+	{actionPrefix: "indices:data/read/search", threshold: 5 * time.Minute},
+	{actionPrefix: "indices:data/read/scroll", threshold: 5 * time.Minute},
+	{actionPrefix: "indices:data/read/msearch", threshold: 5 * time.Minute},
+	{actionPrefix: "indices:data/write/bulk", threshold: 5 * time.Minute},
+	{actionPrefix: "indices:data/write/reindex", threshold: 12 * time.Hour},
+	{actionPrefix: "indices:data/write/update/byquery", threshold: 6 * time.Hour},
+	{actionPrefix: "indices:data/write/delete/byquery", threshold: 6 * time.Hour},
+	{actionPrefix: "indices:admin/forcemerge", threshold: 12 * time.Hour},
+	{actionPrefix: "cluster:admin/snapshot", threshold: 12 * time.Hour},
+}
+
+// how many times over the median number of tasks per node a node needs to be so we advise about it
+const tasksPerNodeAdviceFactor float64 = 2.0
+
+// min number of tasks in a node before we consider it as concentrating tasks
+const tasksPerNodeAdviceMin = 20
+
+// how many of the most common task actions are shown
+const taskActionsToShow = 5
+
+func (d *Diagnostics) processTasks(ctx context.Context) error {
+	total := 0
+	actions := map[string]int{}
+	tasksPerNode := map[string]int{}
+	actionsPerNode := map[string]map[string]int{}
+
+	var visit func(task *Task)
+	visit = func(task *Task) {
+		total++
+		actions[task.Action]++
+		tasksPerNode[task.Task.Node]++
+		if _, ok := actionsPerNode[task.Task.Node]; !ok {
+			actionsPerNode[task.Task.Node] = map[string]int{}
+		}
+		actionsPerNode[task.Task.Node][task.Action]++
+		for _, child := range task.Children {
+			visit(child)
+		}
+	}
+	for _, task := range d.Tasks {
+		visit(task)
+		// children of a long running task are part of the same operation, so we only check top
+		// level tasks to avoid flagging the same operation multiple times
+		d.checkLongRunningTask(task)
+	}
+
+	if total == 0 {
+		return nil
+	}
+
+	d.Comment(S011_Tasks, total, len(d.Tasks), topCounts(actions, taskActionsToShow))
+
+	counts := []int{}
+	for _, node := range d.Nodes.All {
+		counts = append(counts, tasksPerNode[node.ID])
+	}
+	pct := math.PercentilesInt(counts, 10)
+	if pct == nil || pct[5] == 0 {
+		return nil
+	}
+	median := pct[5]
+	for _, node := range d.Nodes.All {
+		count := tasksPerNode[node.ID]
+		if count >= tasksPerNodeAdviceMin && float64(count) > float64(median)*tasksPerNodeAdviceFactor {
+			d.Comment(
+				A011_NodeConcentratingTasks, node.Name, count, float64(count)/float64(median), median,
+				topCounts(actionsPerNode[node.ID], taskActionsToShow),
+			)
+		}
+	}
+
+	return nil
+}
+
+func (d *Diagnostics) checkLongRunningTask(task *Task) {
+	threshold, ok := taskThresholdFor(task.Action)
+	if !ok {
+		return
+	}
+	running := time.Duration(task.RunningTimeInNanos)
+	if running <= threshold {
+		return
+	}
+	nodeName := task.Task.Node
+	if task.Node != nil {
+		nodeName = task.Node.Name
+	}
+	running = running.Round(time.Second)
+	if task.Cancellable {
+		d.Comment(
+			W011_LongRunningTask, task.ID, task.Action, nodeName, running, threshold, task.Description,
+			task.ID,
+		)
+	} else {
+		d.Comment(
+			W012_LongRunningNonCancellableTask, task.ID, task.Action, nodeName, running, threshold,
+			task.Description, task.ID, nodeName,
+		)
+	}
+}
+
+func taskThresholdFor(action string) (time.Duration, bool) {
+	for _, t := range taskThresholds {
+		if strings.HasPrefix(action, t.actionPrefix) {
+			return t.threshold, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,296 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"esdoctor/util"
+)
+
+const I062_IndexTemplate = "I062: " +
+	"%s template %s (patterns %s, %s %d) applies to %d of the existing indices"
+
+const S062_IndexTemplates = "S062: " +
+	"%d legacy and %d composable index templates, built from %d component templates. %d of them " +
+	"match no existing index"
+
+const W062_TemplatesConflictSamePrecedence = "W062: " +
+	"%s templates %s and %s have the same %s (%d) and overlap (%s), but set %s differently. Which " +
+	"value indices matching both get is undefined. Give them a different %s or make them not overlap"
+
+const A062_TemplatesConflict = "A062: " +
+	"%s templates %s and %s overlap (%s) and set %s differently, so indices matching both get the " +
+	"value of %s, which has the higher %s. Make sure this is intended, or make the patterns not overlap"
+
+const A063_UnusedTemplates = "A063: " +
+	"Index templates match no existing index: %s. They may be left over from indices long gone, " +
+	"or have patterns not matching the indices they are meant for. Check and delete the unused ones"
+
+const W064_LegacyTemplateShadowed = "W064: " +
+	"Legacy template %s overlaps composable template %s (%s). Legacy templates are not applied to " +
+	"indices matched by any composable template, so its settings, mappings and aliases are ignored " +
+	"for them. Migrate it to a composable template"
+
+const W065_TemplateNoReplicas = "W065: " +
+	"%s template %s creates indices with no replicas (patterns %s). A node going down makes these " +
+	"indices red. Set index.number_of_replicas to at least 1 in the template"
+
+const W066_TemplateSingleShardLargeIndices = "W066: " +
+	"%s template %s creates indices with a single shard, but indices created from it hold up to %s " +
+	"(%s), above the recommended max of %s per shard. Large shards are slow to recover and " +
+	"relocate. Raise index.number_of_shards in the template or roll the indices over earlier"
+
+// above this primary shard size recovering and relocating shards becomes slow
+// TODO make it configurable
+const maxRecommendedShardSize int64 = 50 * 1024 * 1024 * 1024
+
+// max number of unused templates listed in A063
+const unusedTemplatesToShow = 20
+
+// Legacy or composable index template, normalized so both can be compared
+type indexTemplate struct {
+	name     string
+	legacy   bool
+	patterns []string
+	// order of legacy templates, priority of composable ones
+	precedence int
+	settings   map[string]string
+	// managed by Elasticsearch itself, eg the built-in logs template
+	managed bool
+	// names of the existing indices matching the patterns
+	indices []string
+}
+
+func (t *indexTemplate) kind() string {
+	if t.legacy {
+		return "Legacy"
+	}
+	return "Composable"
+}
+
+func (t *indexTemplate) precedenceName() string {
+	if t.legacy {
+		return "order"
+	}
+	return "priority"
+}
+
+// Legacy templates, along with the composable ones when available, sorted by name
+func (d *Diagnostics) indexTemplates() []*indexTemplate {
+	result := []*indexTemplate{}
+	if d.Cluster.State != nil {
+		for name, template := range d.Cluster.State.Metadata.Templates {
+			settings := map[string]string{}
+			if value := template.Settings.Index.NumberOfShards; value != "" {
+				settings["index.number_of_shards"] = value
+			}
+			if value := template.Settings.Index.NumberOfReplicas; value != "" {
+				settings["index.number_of_replicas"] = value
+			}
+			result = append(result, &indexTemplate{
+				name:       name,
+				legacy:     true,
+				patterns:   template.IndexPatterns,
+				precedence: template.Order,
+				settings:   settings,
+				managed:    strings.HasPrefix(name, "."),
+			})
+		}
+	}
+	if d.Cluster.Templates != nil {
+		for name, template := range d.Cluster.Templates.Composable {
+			result = append(result, &indexTemplate{
+				name:       name,
+				patterns:   template.IndexPatterns,
+				precedence: template.Priority,
+				settings:   d.Cluster.Templates.ResolvedSettings(name),
+				managed:    template.Managed() || strings.HasPrefix(name, "."),
+			})
+		}
+	}
+	sort.Slice(result, func(i int, j int) bool {
+		if result[i].name != result[j].name {
+			return result[i].name < result[j].name
+		}
+		return result[i].legacy
+	})
+
+	indexNames := d.sortedIndexNames()
+	for _, template := range result {
+		for _, indexName := range indexNames {
+			for _, pattern := range template.patterns {
+				if matchesIndexPattern(pattern, indexName) {
+					template.indices = append(template.indices, indexName)
+					break
+				}
+			}
+		}
+	}
+	return result
+}
+
+// Describes how two templates overlap: through an existing index matching both, or a pattern of one
+// of them matching a pattern of the other. Empty when they do not overlap
+func templatesOverlap(a *indexTemplate, b *indexTemplate) string {
+	matched := map[string]struct{}{}
+	for _, indexName := range a.indices {
+		matched[indexName] = struct{}{}
+	}
+	for _, indexName := range b.indices {
+		if _, ok := matched[indexName]; ok {
+			return fmt.Sprintf("eg index %s matches both", indexName)
+		}
+	}
+	for _, patternA := range a.patterns {
+		for _, patternB := range b.patterns {
+			if matchesIndexPattern(patternA, patternB) || matchesIndexPattern(patternB, patternA) {
+				return fmt.Sprintf("patterns %s and %s", patternA, patternB)
+			}
+		}
+	}
+	return ""
+}
+
+// Settings both templates set to different values, formatted as "setting (a vs b)"
+func conflictingSettings(a *indexTemplate, b *indexTemplate) []string {
+	result := []string{}
+	for key, valueA := range a.settings {
+		if valueB, ok := b.settings[key]; ok && valueA != valueB {
+			result = append(result, fmt.Sprintf("%s (%s vs %s)", key, valueA, valueB))
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Template an index is created from: the composable template with the highest priority matching
+// it, otherwise the legacy template with the highest order
+func appliedTemplate(templates []*indexTemplate, indexName string) *indexTemplate {
+	var result *indexTemplate
+	for _, template := range templates {
+		matches := false
+		for _, pattern := range template.patterns {
+			if matchesIndexPattern(pattern, indexName) {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+		if result == nil || (result.legacy && !template.legacy) ||
+			(result.legacy == template.legacy && template.precedence > result.precedence) {
+			result = template
+		}
+	}
+	return result
+}
+
+func (d *Diagnostics) processTemplates(ctx context.Context) error {
+	if d.Cluster == nil {
+		return nil
+	}
+	templates := d.indexTemplates()
+	if len(templates) == 0 {
+		return nil
+	}
+
+	legacy, unused := 0, []string{}
+	for _, template := range templates {
+		if template.legacy {
+			legacy++
+		}
+		d.Comment(
+			I062_IndexTemplate, template.kind(), template.name, strings.Join(template.patterns, ", "),
+			template.precedenceName(), template.precedence, len(template.indices),
+		)
+		if len(template.indices) == 0 && !template.managed {
+			unused = append(unused, template.name)
+		}
+	}
+	components := 0
+	if d.Cluster.Templates != nil {
+		components = len(d.Cluster.Templates.Components)
+	}
+	d.Comment(S062_IndexTemplates, legacy, len(templates)-legacy, components, len(unused))
+	if len(unused) > 0 {
+		if len(unused) > unusedTemplatesToShow {
+			unused = append(unused[:unusedTemplatesToShow], "...")
+		}
+		d.Comment(A063_UnusedTemplates, strings.Join(unused, ", "))
+	}
+
+	for i, a := range templates {
+		for _, b := range templates[i+1:] {
+			overlap := templatesOverlap(a, b)
+			if overlap == "" {
+				continue
+			}
+			if a.legacy != b.legacy {
+				legacyTemplate, composableTemplate := a, b
+				if b.legacy {
+					legacyTemplate, composableTemplate = b, a
+				}
+				if !legacyTemplate.managed {
+					d.Comment(W064_LegacyTemplateShadowed, legacyTemplate.name, composableTemplate.name, overlap)
+				}
+				continue
+			}
+			conflicts := conflictingSettings(a, b)
+			if len(conflicts) == 0 {
+				continue
+			}
+			if a.precedence == b.precedence {
+				d.Comment(
+					W062_TemplatesConflictSamePrecedence, a.kind(), a.name, b.name, a.precedenceName(), a.precedence,
+					overlap, strings.Join(conflicts, ", "), a.precedenceName(),
+				)
+				continue
+			}
+			winner := a
+			if b.precedence > a.precedence {
+				winner = b
+			}
+			d.Comment(
+				A062_TemplatesConflict, a.kind(), a.name, b.name, overlap, strings.Join(conflicts, ", "), winner.name,
+				a.precedenceName(),
+			)
+		}
+	}
+
+	// the largest index (by primaries size) created from each template
+	largest := map[*indexTemplate]*Index{}
+	for _, indexName := range d.sortedIndexNames() {
+		index := d.Indices[indexName]
+		template := appliedTemplate(templates, indexName)
+		if template == nil || index.Stats == nil {
+			continue
+		}
+		if current, ok := largest[template]; !ok ||
+			index.Stats.Primaries.Store.SizeInBytes > current.Stats.Primaries.Store.SizeInBytes {
+			largest[template] = index
+		}
+	}
+	for _, template := range templates {
+		if template.managed {
+			continue
+		}
+		if template.settings["index.number_of_replicas"] == "0" {
+			d.Comment(W065_TemplateNoReplicas, template.kind(), template.name, strings.Join(template.patterns, ", "))
+		}
+		index, ok := largest[template]
+		if !ok || template.settings["index.number_of_shards"] != "1" {
+			continue
+		}
+		if size := index.Stats.Primaries.Store.SizeInBytes; size > maxRecommendedShardSize {
+			d.Comment(
+				W066_TemplateSingleShardLargeIndices, template.kind(), template.name, util.HumanizeBytes(size),
+				index.Name, util.HumanizeBytes(maxRecommendedShardSize),
+			)
+		}
+	}
+
+	return nil
+}
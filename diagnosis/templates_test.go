@@ -0,0 +1,81 @@
+package diagnosis
+
+import (
+	"context"
+	"testing"
+
+	"esdoctor/metadata"
+	"esdoctor/stats"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessTemplates(t *testing.T) {
+	d := Diagnostics{
+		Cluster: &Cluster{
+			State: &metadata.ClusterState{},
+			Templates: &metadata.IndexTemplates{
+				Composable: map[string]metadata.ComposableTemplate{
+					"logs-app": {
+						IndexPatterns: []string{"logs-app-*"},
+						ComposedOf:    []string{"defaults"},
+						Priority:      200,
+						Template: metadata.TemplateContent{
+							Settings: map[string]interface{}{"index.number_of_shards": "1"},
+						},
+					},
+					"logs": {
+						IndexPatterns: []string{"logs-*-*"},
+						Priority:      100,
+						Meta:          map[string]interface{}{"managed": true},
+					},
+				},
+				Components: map[string]metadata.ComponentTemplate{
+					"defaults": {Template: metadata.TemplateContent{
+						Settings: map[string]interface{}{"index.number_of_shards": "3", "index.number_of_replicas": "0"},
+					}},
+				},
+			},
+		},
+		Indices: map[string]*Index{},
+	}
+	d.Cluster.State.Metadata.Templates = map[string]metadata.Template{}
+	addLegacy := func(name string, order int, shards string, patterns ...string) {
+		template := metadata.Template{Order: order, IndexPatterns: patterns}
+		template.Settings.Index.NumberOfShards = shards
+		d.Cluster.State.Metadata.Templates[name] = template
+	}
+	addLegacy("events", 0, "2", "events-*")
+	addLegacy("events-web", 0, "4", "events-web-*")
+	addLegacy("legacy-logs", 1, "", "logs-*")
+	addLegacy("old", 0, "", "old-*")
+	addIndex := func(name string, primaryBytes int64) {
+		index := Index{Name: name, Stats: &stats.Index{}}
+		index.Stats.Primaries.Store.SizeInBytes = primaryBytes
+		d.Indices[name] = &index
+	}
+	addIndex("events-web-2021.01.31", 0)
+	addIndex("logs-app-2021.01.31", 60*1024*1024*1024)
+
+	assert.NoError(t, d.processTemplates(context.Background()))
+	codes := commentsByCode(&d)
+	assert.Len(t, codes["I062"], 6)
+	assert.Equal(t, []string{
+		"4 legacy and 2 composable index templates, built from 1 component templates. 1 of them match no " +
+			"existing index",
+	}, codes["S062"])
+	assert.Len(t, codes["A063"], 1)
+	assert.Contains(t, codes["A063"][0], "existing index: old.")
+	assert.Equal(t, []string{
+		"Legacy templates events and events-web have the same order (0) and overlap (eg index " +
+			"events-web-2021.01.31 matches both), but set index.number_of_shards (2 vs 4) differently. Which " +
+			"value indices matching both get is undefined. Give them a different order or make them not overlap",
+	}, codes["W062"])
+	assert.Len(t, codes["W064"], 2)
+	assert.Contains(t, codes["W064"][0], "Legacy template legacy-logs overlaps composable template logs")
+	// the component template sets no replicas, while the template overrides its shards
+	assert.Len(t, codes["W065"], 1)
+	assert.Contains(t, codes["W065"][0], "Composable template logs-app creates indices with no replicas")
+	assert.Len(t, codes["W066"], 1)
+	assert.Contains(t, codes["W066"][0], "hold up to 60.0gb (logs-app-2021.01.31)")
+}
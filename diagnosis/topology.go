@@ -0,0 +1,157 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const S029_NodeRoles = "S029: " +
+	"Cluster has %d nodes, %d master eligible and %d holding data. Roles (with the number of nodes " +
+	"having each combination): %s"
+
+const W029_TooFewMasters = "W029: " +
+	"Cluster has only %d master eligible node(s) (%s). Electing a master needs a majority of them, " +
+	"so the cluster cannot tolerate losing any of them. Use 3 master eligible nodes"
+
+const A029_EvenMasters = "A029: " +
+	"Cluster has an even number of master eligible nodes (%d), which tolerates losing %d of them, " +
+	"the same as %d nodes would. The extra node does not add resilience, so consider using an odd " +
+	"number of master eligible nodes"
+
+const A030_MastersHoldingData = "A030: " +
+	"Cluster has %d data nodes and %d master eligible nodes also holding data (%s). On large " +
+	"clusters, the load of a data node (heavy searches, long GC pauses) slows the elected master " +
+	"down, delaying cluster state updates for the whole cluster. Use dedicated master nodes"
+
+const A031_NoDedicatedCoordinatingNodes = "A031: " +
+	"Data nodes have an average cpu usage of %d%% and the cluster has no dedicated coordinating " +
+	"nodes, so data nodes also parse requests and reduce search results (eg large aggregations). " +
+	"Dedicated coordinating nodes (no roles) take this work and its memory usage off the data nodes"
+
+const A032_NoDedicatedIngestNodes = "A032: " +
+	"Data nodes have an average cpu usage of %d%% and also run ingest pipelines (%d documents " +
+	"ingested since they started, avg of %v each). Dedicated ingest nodes take the cpu cost of " +
+	"pipelines off the data nodes"
+
+const W030_VotingConfigExclusions = "W030: " +
+	"Voting configuration exclusions are set for %s. Exclusions are meant to be temporary while " +
+	"removing master eligible nodes, and once left behind they keep the excluded nodes from being " +
+	"voting members again. After the nodes are removed, clear them with DELETE " +
+	"_cluster/voting_config_exclusions"
+
+// from how many data nodes dedicated master nodes are recommended
+// TODO make it configurable
+const dedicatedMastersMinDataNodes = 10
+
+// from which average cpu usage of the data nodes we consider them under heavy load
+const heavyLoadCPUPercent = 80
+
+// min number of documents ingested by data nodes to consider pipelines in use
+const ingestMinDocuments = 1000000
+
+// Data nodes have "data" or data tier roles (eg "data_hot") since ES 7.10
+func isDataRole(role string) bool {
+	return role == "data" || strings.HasPrefix(role, "data_")
+}
+
+// OpenSearch 2 renamed the master role to cluster_manager
+func isMasterRole(role string) bool {
+	return role == "master" || role == "cluster_manager"
+}
+
+func hasRole(node *Node, role string) bool {
+	for _, r := range node.Stats.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Diagnostics) processTopology(ctx context.Context) error {
+	roles := map[string]int{}
+	coordinatingNodes := 0
+	for _, node := range d.Nodes.All {
+		if len(node.Stats.Roles) == 0 {
+			roles["coordinating only"]++
+			coordinatingNodes++
+			continue
+		}
+		nodeRoles := append([]string{}, node.Stats.Roles...)
+		sort.Strings(nodeRoles)
+		roles[strings.Join(nodeRoles, ",")]++
+	}
+	if len(d.Nodes.All) > 0 {
+		d.Comment(
+			S029_NodeRoles, len(d.Nodes.All), len(d.Nodes.Master), len(d.Nodes.Data),
+			topCounts(roles, len(roles)),
+		)
+	}
+
+	masters := sortedNodes(d.Nodes.Master)
+	masterNames := []string{}
+	mastersWithData := []string{}
+	for _, node := range masters {
+		masterNames = append(masterNames, node.Name)
+		if _, ok := d.Nodes.Data[node.ID]; ok {
+			mastersWithData = append(mastersWithData, node.Name)
+		}
+	}
+	if len(masters) > 0 && len(masters) < 3 && len(d.Nodes.All) > 1 {
+		d.Comment(W029_TooFewMasters, len(masters), strings.Join(masterNames, ", "))
+	}
+	if len(masters) >= 4 && len(masters)%2 == 0 {
+		d.Comment(A029_EvenMasters, len(masters), len(masters)/2-1, len(masters)-1)
+	}
+	if len(d.Nodes.Data) >= dedicatedMastersMinDataNodes && len(mastersWithData) > 0 {
+		d.Comment(
+			A030_MastersHoldingData, len(d.Nodes.Data), len(mastersWithData), strings.Join(mastersWithData, ", "),
+		)
+	}
+
+	if len(d.Nodes.Data) > 0 {
+		cpu, ingested, ingestMillis := 0, 0, 0
+		for _, node := range d.Nodes.Data {
+			cpu += node.Stats.Os.CPU.Percent
+			ingested += node.Stats.Ingest.Total.Count
+			ingestMillis += node.Stats.Ingest.Total.TimeInMillis
+		}
+		avgCPU := cpu / len(d.Nodes.Data)
+		if avgCPU >= heavyLoadCPUPercent {
+			if coordinatingNodes == 0 {
+				d.Comment(A031_NoDedicatedCoordinatingNodes, avgCPU)
+			}
+			if ingested >= ingestMinDocuments && !d.hasDedicatedIngestNodes() {
+				d.Comment(A032_NoDedicatedIngestNodes, avgCPU, ingested, avgMillis(ingestMillis, ingested))
+			}
+		}
+	}
+
+	if d.Cluster.State != nil {
+		exclusions := []string{}
+		for _, exclusion := range d.Cluster.State.Metadata.ClusterCoordination.VotingConfigExclusions {
+			name := exclusion.NodeName
+			if name == "" || name == "_absent_" {
+				name = exclusion.NodeID
+			}
+			exclusions = append(exclusions, fmt.Sprintf("%q", name))
+		}
+		if len(exclusions) > 0 {
+			d.Comment(W030_VotingConfigExclusions, strings.Join(exclusions, ", "))
+		}
+	}
+
+	return nil
+}
+
+// Whether some node runs ingest pipelines without holding data
+func (d *Diagnostics) hasDedicatedIngestNodes() bool {
+	for id, node := range d.Nodes.All {
+		if _, ok := d.Nodes.Data[id]; !ok && hasRole(node, "ingest") {
+			return true
+		}
+	}
+	return false
+}
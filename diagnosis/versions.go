@@ -0,0 +1,142 @@
+package diagnosis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"esdoctor/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const I033_NodeVersions = "I033: " +
+	"Node %s runs %s %s on %s, with the %s %s JVM (bundled: %t) and plugins: %s"
+
+const W033_MixedVersions = "W033: " +
+	"Nodes run different %s versions: %s. Mixed versions are only meant to last during a rolling " +
+	"upgrade: shards cannot move from newer to older nodes, and features of the newer version are " +
+	"unavailable until all nodes are upgraded. Complete the upgrade"
+
+const W034_MixedJVMs = "W034: " +
+	"Nodes run different JVMs: %s. JVM vendors and versions differ in GC, TLS and performance, " +
+	"making nodes behave differently and issues hard to track down. Run the same JVM on all nodes, " +
+	"preferably the bundled one"
+
+const W035_MixedPlugins = "W035: " +
+	"Nodes have different sets of plugins: %s. Plugins need to be installed on all nodes, otherwise " +
+	"what they provide (eg analyzers, repository types) fails on the nodes missing them"
+
+const W036_IndicesNotReadableByNextMajor = "W036: " +
+	"%d indices were created on versions the next major version will not be able to read, as it " +
+	"only reads indices created on %s %d.x or later: %s. Reindex them (or wait for them to be " +
+	"deleted) before upgrading"
+
+// max number of indices listed in W036
+const oldIndicesToShow = 20
+
+// Groups node names by a value (eg their version) and formats them as "value (node1, node2)"
+func formatNodeGroups(groups map[string][]string) string {
+	values := []string{}
+	for value, names := range groups {
+		values = append(values, value)
+		sort.Strings(names)
+	}
+	sort.Strings(values)
+	msg := []string{}
+	for _, value := range values {
+		msg = append(msg, fmt.Sprintf("%s (%s)", value, strings.Join(groups[value], ", ")))
+	}
+	return strings.Join(msg, ", ")
+}
+
+func distributionName(v version.ESVersion) string {
+	if v.OpenSearch() {
+		return "OpenSearch"
+	}
+	return "Elasticsearch"
+}
+
+// Major version generation used to tell which index versions can be read. OpenSearch 1 forked
+// from Elasticsearch 7, and reads the same indices
+func versionGeneration(v version.ESVersion) int {
+	if v.OpenSearch() {
+		return v.Major + 6
+	}
+	return v.Major
+}
+
+func (d *Diagnostics) processVersions(ctx context.Context) error {
+	distribution := distributionName(d.Version)
+	versions := map[string][]string{}
+	jvms := map[string][]string{}
+	plugins := map[string][]string{}
+	for _, node := range sortedNodes(d.Nodes.All) {
+		info := node.Info
+		if info == nil {
+			continue
+		}
+		pluginNames := []string{}
+		for _, plugin := range info.Plugins {
+			pluginNames = append(pluginNames, plugin.Name)
+		}
+		sort.Strings(pluginNames)
+		pluginSet := strings.Join(pluginNames, ",")
+		if pluginSet == "" {
+			pluginSet = "none"
+		}
+		jvm := fmt.Sprintf("%s %s", info.Jvm.VMVendor, info.Jvm.Version)
+
+		d.Comment(
+			I033_NodeVersions, node.Name, distribution, info.Version, info.Os.PrettyName, info.Jvm.VMVendor,
+			info.Jvm.Version, info.Jvm.UsingBundledJdk, pluginSet,
+		)
+		versions[info.Version] = append(versions[info.Version], node.Name)
+		jvms[jvm] = append(jvms[jvm], node.Name)
+		plugins[pluginSet] = append(plugins[pluginSet], node.Name)
+	}
+	if len(versions) > 1 {
+		d.Comment(W033_MixedVersions, distribution, formatNodeGroups(versions))
+	}
+	if len(jvms) > 1 {
+		d.Comment(W034_MixedJVMs, formatNodeGroups(jvms))
+	}
+	if len(plugins) > 1 {
+		d.Comment(W035_MixedPlugins, formatNodeGroups(plugins))
+	}
+
+	if !d.Version.Set() {
+		return nil
+	}
+	oldIndices := []string{}
+	for _, indexName := range d.sortedIndexNames() {
+		created := d.Indices[indexName].Metadata.Settings.Index.Version.Created
+		if created == "" {
+			continue
+		}
+		createdVersion, err := version.ParseID(created)
+		if err != nil {
+			log.Errorf("failed to read the version index %s was created on: %v", indexName, err)
+			continue
+		}
+		if versionGeneration(createdVersion) < versionGeneration(d.Version) {
+			oldIndices = append(oldIndices, fmt.Sprintf(
+				"%s (%s %d.%d)", indexName, distributionName(createdVersion), createdVersion.Major,
+				createdVersion.Minor,
+			))
+		}
+	}
+	if len(oldIndices) > 0 {
+		total := len(oldIndices)
+		if total > oldIndicesToShow {
+			oldIndices = append(oldIndices[:oldIndicesToShow], "...")
+		}
+		d.Comment(
+			W036_IndicesNotReadableByNextMajor, total, distribution, d.Version.Major,
+			strings.Join(oldIndices, ", "),
+		)
+	}
+
+	return nil
+}
@@ -1,9 +1,12 @@
 package fetch
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 
 	"esdoctor/client"
 )
@@ -13,11 +16,30 @@ func Fetch(ctx context.Context, client client.Versioned, api string, obj interfa
 	if err != nil {
 		return err
 	}
+	return decode(resp, api, obj)
+}
+
+// Same as Fetch, but sends the passed body json encoded with the request using the given http method
+func FetchWithBody(ctx context.Context, client client.Versioned, method string, api string, body interface{}, obj interface{}) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to json encode the request body for %s: %w", api, err)
+	}
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	resp, err := client.Request(ctx, method, api, headers, ioutil.NopCloser(bytes.NewReader(encoded)))
+	if err != nil {
+		return err
+	}
+	return decode(resp, api, obj)
+}
+
+func decode(resp *http.Response, api string, obj interface{}) error {
+	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
 		return fmt.Errorf("failed to fetch %s, got status code %d from ES", api, resp.StatusCode)
 	}
 
-	defer resp.Body.Close()
 	decoder := json.NewDecoder(resp.Body)
 	if err := decoder.Decode(&obj); err != nil {
 		return fmt.Errorf("failed to json decode the response from %s: %w", api, err)
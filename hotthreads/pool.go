@@ -0,0 +1,58 @@
+package hotthreads
+
+import (
+	"strings"
+)
+
+const PoolMerge = "merge"
+const PoolOther = "other"
+
+// Elasticsearch names its thread pool threads in the elasticsearch[<node name>][<pool>][T#<n>]
+// format, eg elasticsearch[node-1][search][T#3]. Lucene merge threads are not part of a thread
+// pool and are named after the shard being merged, eg
+// elasticsearch[node-1][[my-index][0]: Lucene Merge Thread #12]. Threads not following any of
+// these formats are classified as PoolOther
+func ThreadPool(threadName string) string {
+	if strings.Contains(threadName, "Lucene Merge Thread") {
+		return PoolMerge
+	}
+	for _, prefix := range []string{"elasticsearch[", "opensearch["} {
+		if !strings.HasPrefix(threadName, prefix) {
+			continue
+		}
+		rest := threadName[len(prefix):]
+		// skip the node name
+		idx := strings.Index(rest, "][")
+		if idx < 0 {
+			return PoolOther
+		}
+		rest = rest[idx+2:]
+		end := strings.Index(rest, "]")
+		if end <= 0 {
+			return PoolOther
+		}
+		return rest[:end]
+	}
+	return PoolOther
+}
+
+func (t *Thread) Pool() string {
+	return ThreadPool(t.Name)
+}
+
+// Returns the most relevant frame of the snapshot stack: the first frame from Elasticsearch,
+// OpenSearch or Lucene code, as the frames above it are usually generic jdk frames (eg
+// sun.nio.ch.EPoll.wait). If there is no such frame, the top of the stack is returned
+func (s *SnapshotSummary) TopFrame() string {
+	for _, frame := range s.Stack {
+		for _, pkg := range []string{"org.elasticsearch.", "org.opensearch.", "org.apache.lucene."} {
+			if strings.Contains(frame, pkg) {
+				return frame
+			}
+		}
+	}
+	if len(s.Stack) > 0 {
+		return s.Stack[0]
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package hotthreads
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThreadPool(t *testing.T) {
+	test := func(threadName string, expected string) {
+		assert.Equal(t, expected, ThreadPool(threadName), "wrong pool for thread %q", threadName)
+	}
+
+	test("elasticsearch[b60e77028320a7e79f0bd16a9c15cb61][refresh][T#4]", "refresh")
+	test("elasticsearch[node-1][search][T#3]", "search")
+	test("elasticsearch[node-1][write][T#12]", "write")
+	test("elasticsearch[node-1][transport_worker][T#1]", "transport_worker")
+	test("opensearch[node-1][management][T#2]", "management")
+	test("elasticsearch[node-1][[my-index][0]: Lucene Merge Thread #12]", PoolMerge)
+
+	// AWS hides some thread names, also missing the closing brackets
+	test("[AMAZON INTERNAL]", PoolOther)
+	test("elasticsearch[node-1]", PoolOther)
+	test("Connection evictor", PoolOther)
+	test("", PoolOther)
+}
+
+func TestTopFrame(t *testing.T) {
+	summary := SnapshotSummary{
+		Stack: []string{
+			"java.base@11.0.2/sun.nio.ch.EPoll.wait(Native Method)",
+			"app//org.elasticsearch.index.engine.InternalEngine.refresh(InternalEngine.java:1631)",
+			"app//org.apache.lucene.index.IndexWriter.flush(IndexWriter.java:3520)",
+		},
+	}
+	assert.Equal(t, summary.Stack[1], summary.TopFrame())
+
+	summary.Stack = summary.Stack[:1]
+	assert.Equal(t, summary.Stack[0], summary.TopFrame())
+
+	summary.Stack = []string{}
+	assert.Equal(t, "", summary.TopFrame())
+}
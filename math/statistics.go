@@ -89,3 +89,27 @@ func PercentilesFloat64(slice []float64, buckets int) []float64 {
 func percentileIdx(idx int, buckets int, length int) int {
 	return int(float64(idx) / float64(buckets) * float64(length))
 }
+
+// Fits a line through the given points with ordinary least squares, returning its slope and
+// intercept. xs and ys need to have the same length. With less than two distinct xs no line can
+// be fitted, and ok is false
+func LinearFit(xs []float64, ys []float64) (slope float64, intercept float64, ok bool) {
+	if len(xs) < 2 || len(xs) != len(ys) {
+		return 0, 0, false
+	}
+	n := float64(len(xs))
+	var sumX, sumY, sumXY, sumXX float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+		sumXY += xs[i] * ys[i]
+		sumXX += xs[i] * xs[i]
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, 0, false
+	}
+	slope = (n*sumXY - sumX*sumY) / denominator
+	intercept = (sumY - slope*sumX) / n
+	return slope, intercept, true
+}
@@ -171,3 +171,21 @@ func TestPercentiles(t *testing.T) {
 	input = []int{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100}
 	test(input, 0, 10, 50, 90, 100)
 }
+
+func TestLinearFit(t *testing.T) {
+	slope, intercept, ok := LinearFit([]float64{0, 1, 2, 3}, []float64{10, 12, 14, 16})
+	assert.True(t, ok)
+	assert.InDelta(t, 2.0, slope, 1e-9)
+	assert.InDelta(t, 10.0, intercept, 1e-9)
+
+	// noisy points around y = -x + 5
+	slope, intercept, ok = LinearFit([]float64{0, 1, 2, 3}, []float64{5.1, 3.9, 3.1, 1.9})
+	assert.True(t, ok)
+	assert.InDelta(t, -1.04, slope, 1e-9)
+	assert.InDelta(t, 5.06, intercept, 1e-9)
+
+	_, _, ok = LinearFit([]float64{1}, []float64{1})
+	assert.False(t, ok)
+	_, _, ok = LinearFit([]float64{2, 2}, []float64{1, 3})
+	assert.False(t, ok)
+}
@@ -0,0 +1,64 @@
+package metadata
+
+import (
+	"context"
+
+	"esdoctor/client"
+	"esdoctor/fetch"
+)
+
+func GetAllocationExplanation(ctx context.Context, client client.Versioned, index IndexName, shard int, primary bool) (*AllocationExplanation, error) {
+	result := AllocationExplanation{}
+	body := map[string]interface{}{
+		"index":   index,
+		"shard":   shard,
+		"primary": primary,
+	}
+	return &result, fetch.FetchWithBody(ctx, client, "POST", "_cluster/allocation/explain", body, &result)
+}
+
+// NOTE: The structs in this package were generated by getting responses from ES, using
+// this handy tool at https://mholt.github.io/json-to-go/ and making adjustments
+
+type AllocationExplanation struct {
+	Index          string `json:"index"`
+	Shard          int    `json:"shard"`
+	Primary        bool   `json:"primary"`
+	CurrentState   string `json:"current_state"`
+	UnassignedInfo struct {
+		Reason                   string `json:"reason"`
+		At                       string `json:"at"`
+		FailedAllocationAttempts int    `json:"failed_allocation_attempts"`
+		Details                  string `json:"details"`
+		LastAllocationStatus     string `json:"last_allocation_status"`
+	} `json:"unassigned_info"`
+	CurrentNode *struct {
+		ID               string            `json:"id"`
+		Name             string            `json:"name"`
+		TransportAddress string            `json:"transport_address"`
+		Attributes       map[string]string `json:"attributes"`
+	} `json:"current_node"`
+	CanAllocate             string                     `json:"can_allocate"`
+	AllocateExplanation     string                     `json:"allocate_explanation"`
+	CanRemainOnCurrentNode  string                     `json:"can_remain_on_current_node"`
+	CanMoveToOtherNode      string                     `json:"can_move_to_other_node"`
+	MoveExplanation         string                     `json:"move_explanation"`
+	NodeAllocationDecisions []NodeAllocationDecision   `json:"node_allocation_decisions"`
+	CanRemainDecisions      []AllocationDeciderOutcome `json:"can_remain_decisions"`
+}
+
+type NodeAllocationDecision struct {
+	NodeID           string                     `json:"node_id"`
+	NodeName         string                     `json:"node_name"`
+	TransportAddress string                     `json:"transport_address"`
+	NodeAttributes   map[string]string          `json:"node_attributes"`
+	NodeDecision     string                     `json:"node_decision"`
+	WeightRanking    int                        `json:"weight_ranking"`
+	Deciders         []AllocationDeciderOutcome `json:"deciders"`
+}
+
+type AllocationDeciderOutcome struct {
+	Decider     string `json:"decider"`
+	Decision    string `json:"decision"`
+	Explanation string `json:"explanation"`
+}
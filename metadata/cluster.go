@@ -17,6 +17,11 @@ func GetClusterHealth(ctx context.Context, client client.Versioned) (*ClusterHea
 	return &result, fetch.Fetch(ctx, client, "_cluster/health", &result)
 }
 
+func GetPendingTasks(ctx context.Context, client client.Versioned) (*PendingTasks, error) {
+	result := PendingTasks{}
+	return &result, fetch.Fetch(ctx, client, "_cluster/pending_tasks", &result)
+}
+
 // NOTE: The structs in this package were generated by getting responses from ES, using
 // this handy tool at https://mholt.github.io/json-to-go/ and making adjustments
 
@@ -61,16 +66,15 @@ type ClusterMetadata struct {
 	ClusterUUID          string `json:"cluster_uuid"`
 	ClusterUUIDCommitted bool   `json:"cluster_uuid_committed"`
 	ClusterCoordination  struct {
-		Term                   int           `json:"term"`
-		LastCommittedConfig    []string      `json:"last_committed_config"`
-		LastAcceptedConfig     []string      `json:"last_accepted_config"`
-		VotingConfigExclusions []interface{} `json:"voting_config_exclusions"`
+		Term                   int                     `json:"term"`
+		LastCommittedConfig    []string                `json:"last_committed_config"`
+		LastAcceptedConfig     []string                `json:"last_accepted_config"`
+		VotingConfigExclusions []VotingConfigExclusion `json:"voting_config_exclusions"`
 	} `json:"cluster_coordination"`
 	Templates  map[TemplateName]Template `json:"templates"`
 	Indices    map[IndexName]IndexState  `json:"indices"`
 	DataStream struct {
-		DataStream struct {
-		} `json:"data_stream"`
+		DataStreams map[string]DataStream `json:"data_stream"`
 	} `json:"data_stream"`
 	Repositories   map[string]Repository `json:"repositories"`
 	IndexGraveyard struct {
@@ -78,6 +82,28 @@ type ClusterMetadata struct {
 	} `json:"index-graveyard"`
 }
 
+type DataStream struct {
+	Name           string `json:"name"`
+	TimestampField struct {
+		Name string `json:"name"`
+	} `json:"timestamp_field"`
+	// backing indices, the last one being the write index
+	Indices    []DataStreamIndex `json:"indices"`
+	Generation int               `json:"generation"`
+	Hidden     bool              `json:"hidden"`
+	System     bool              `json:"system"`
+}
+
+type DataStreamIndex struct {
+	IndexName IndexName `json:"index_name"`
+	IndexUUID string    `json:"index_uuid"`
+}
+
+type VotingConfigExclusion struct {
+	NodeID   string `json:"node_id"`
+	NodeName string `json:"node_name"`
+}
+
 type Template struct {
 	Order         int      `json:"order"`
 	IndexPatterns []string `json:"index_patterns"`
@@ -109,6 +135,12 @@ type Tombstone struct {
 	DeleteDateInMillis int64 `json:"delete_date_in_millis"`
 }
 
+// States of an index in the cluster state
+const (
+	IndexStateOpen  = "open"
+	IndexStateClose = "close"
+)
+
 type IndexState struct {
 	Version          int    `json:"version"`
 	MappingVersion   int    `json:"mapping_version"`
@@ -170,3 +202,16 @@ type ClusterHealth struct {
 	NumberOfInFlightFetch       int    `json:"number_of_in_flight_fetch"`
 	TaskMaxWaitingInQueueMillis int    `json:"task_max_waiting_in_queue_millis"`
 }
+
+type PendingTasks struct {
+	Tasks []PendingTask `json:"tasks"`
+}
+
+type PendingTask struct {
+	InsertOrder       int    `json:"insert_order"`
+	Priority          string `json:"priority"`
+	Source            string `json:"source"`
+	Executing         bool   `json:"executing"`
+	TimeInQueueMillis int64  `json:"time_in_queue_millis"`
+	TimeInQueue       string `json:"time_in_queue"`
+}
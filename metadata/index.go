@@ -19,6 +19,7 @@ func GetIndexes(ctx context.Context, client client.Versioned) (Indices, error) {
 	// for each index we merge the default settings with the specified settings, forming a
 	// single view of all the settings the index has
 	for k, v := range decoded {
+		v := v // the result keeps a reference to it, so it cannot be the loop variable
 		settings := &v.Index.Settings
 		mergo.Merge(settings, v.Defaults)
 		result[k] = &v.Index
@@ -36,16 +37,22 @@ type PropertyName = string
 type Indices = map[IndexName]*Index
 
 type Index struct {
-	Aliases  map[string]interface{} `json:"aliases"`
-	Mappings struct {
-		Dynamic    string                    `json:"dynamic"`
-		Properties map[PropertyName]Property `json:"properties"`
-	}
+	Aliases  map[string]Alias `json:"aliases"`
+	Mappings Mappings         `json:"mappings"`
 	Settings struct {
 		Index IndexSettings `json:"index"`
 	} `json:"settings"`
 }
 
+type Alias struct {
+	// nil unless explicitly set. Aliases of a single index write to it regardless
+	IsWriteIndex  *bool       `json:"is_write_index"`
+	IsHidden      *bool       `json:"is_hidden"`
+	Filter        interface{} `json:"filter"`
+	IndexRouting  string      `json:"index_routing"`
+	SearchRouting string      `json:"search_routing"`
+}
+
 type IndicesWithDefaults = map[IndexName]IndexWithDefaults
 
 type IndexWithDefaults struct {
@@ -55,13 +62,21 @@ type IndexWithDefaults struct {
 	} `json:"defaults"`
 }
 
+type Mappings struct {
+	// "dynamic" changed from boolean to string across versions
+	Dynamic    interface{}               `json:"dynamic"`
+	Properties map[PropertyName]Property `json:"properties"`
+}
+
 type Property struct {
 	Type string `json:"type"`
 	// "dynamic" changed from boolean to string across versions
 	Dynamic    interface{}               `json:"dynamic"`
 	Index      bool                      `json:"index"`
 	Enabled    bool                      `json:"enabled"`
+	Fielddata  bool                      `json:"fielddata"` // only for text fields
 	Properties map[PropertyName]Property `json:"properties"`
+	Fields     map[PropertyName]Property `json:"fields"` // multi-fields
 }
 
 type IndexSettings struct {
@@ -82,6 +97,16 @@ type IndexSettings struct {
 			AutoManage    string `json:"auto_manage"`
 		} `json:"index_state_management"`
 	} `json:"opendistro"`
+	Plugins struct {
+		IndexStateManagement struct {
+			RolloverAlias string `json:"rollover_alias"`
+		} `json:"index_state_management"`
+	} `json:"plugins"`
+	Lifecycle struct {
+		Name             string `json:"name"`
+		RolloverAlias    string `json:"rollover_alias"`
+		IndexingComplete string `json:"indexing_complete"`
+	} `json:"lifecycle"`
 	FlushAfterMerge string `json:"flush_after_merge"`
 	KnnAlgoParam    struct {
 		EfSearch       string `json:"ef_search"`
@@ -219,6 +244,7 @@ type IndexSettings struct {
 	} `json:"snapshot"`
 	MaxNgramDiff string `json:"max_ngram_diff"`
 	Hidden       string `json:"hidden"`
+	Frozen       string `json:"frozen"`
 	Translog     struct {
 		GenerationThresholdSize string `json:"generation_threshold_size"`
 		FlushThresholdSize      string `json:"flush_threshold_size"`
@@ -263,6 +289,11 @@ type IndexSettings struct {
 		Allocation struct {
 			Enable             string `json:"enable"`
 			TotalShardsPerNode string `json:"total_shards_per_node"`
+			// allocation filters by node attribute, or by the built-in _name, _host, _ip, _id and _tier
+			// ones. Values are nested when attribute names have dots, see FlatAllocationFilter
+			Require map[string]interface{} `json:"require"`
+			Include map[string]interface{} `json:"include"`
+			Exclude map[string]interface{} `json:"exclude"`
 		} `json:"allocation"`
 		SearchPreference string `json:"search_preference"`
 	} `json:"routing"`
@@ -356,3 +387,20 @@ type IndexSettings struct {
 		Lenient string `json:"lenient"`
 	} `json:"query_string"`
 }
+
+// Flattens allocation filters, which come as nested objects for attribute names with dots (eg
+// box.type), into comma separated values by attribute name
+func FlatAllocationFilter(filter map[string]interface{}) map[string]string {
+	result := map[string]string{}
+	for key, value := range filter {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			for nestedKey, nestedValue := range FlatAllocationFilter(value) {
+				result[key+"."+nestedKey] = nestedValue
+			}
+		case string:
+			result[key] = value
+		}
+	}
+	return result
+}
@@ -0,0 +1,39 @@
+package metadata
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"esdoctor/client"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetIndexes(t *testing.T) {
+	mock := client.Mock(func(req *http.Request, resp *http.Response) error {
+		resp.Body = ioutil.NopCloser(strings.NewReader(`{
+			"logs": {
+				"settings": {"index": {"number_of_shards": "1", "refresh_interval": "30s"}},
+				"defaults": {"index": {"refresh_interval": "1s", "codec": "default"}}
+			},
+			"metrics": {
+				"settings": {"index": {"number_of_shards": "3"}},
+				"defaults": {"index": {"refresh_interval": "1s", "codec": "default"}}
+			}
+		}`))
+		return nil
+	})
+
+	indices, err := GetIndexes(context.Background(), mock)
+	assert.NoError(t, err)
+	assert.Len(t, indices, 2)
+	assert.Equal(t, "1", indices["logs"].Settings.Index.NumberOfShards)
+	assert.Equal(t, "30s", indices["logs"].Settings.Index.RefreshInterval)
+	assert.Equal(t, "3", indices["metrics"].Settings.Index.NumberOfShards)
+	// defaults fill in what is not set explicitly
+	assert.Equal(t, "1s", indices["metrics"].Settings.Index.RefreshInterval)
+	assert.Equal(t, "default", indices["metrics"].Settings.Index.Codec)
+}
@@ -0,0 +1,246 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"esdoctor/client"
+	"esdoctor/fetch"
+)
+
+const (
+	LifecycleILM = "ILM" // Elastic index lifecycle management
+	LifecycleISM = "ISM" // OpenSearch (and Open Distro) index state management
+)
+
+// Index lifecycle management data, from either Elastic ILM or OpenSearch ISM, normalized to the
+// same shape
+type Lifecycle struct {
+	System string `json:"system"`
+	// prefix of the ISM apis, as it differs between OpenSearch and Open Distro. Empty for ILM
+	API      string                        `json:"api,omitempty"`
+	Policies map[string]*LifecyclePolicy   `json:"policies"`
+	Indices  map[IndexName]*IndexLifecycle `json:"-"` // linked from each index
+}
+
+type LifecyclePolicy struct {
+	Name string `json:"name"`
+	// ILM phases or ISM states of the policy
+	Phases    []string `json:"phases"`
+	Deletes   bool     `json:"deletes"`
+	RollsOver bool     `json:"rolls_over"`
+}
+
+// Lifecycle state of a managed index. Phase is the ILM phase or the ISM state
+type IndexLifecycle struct {
+	Policy     string `json:"policy"`
+	Phase      string `json:"phase"`
+	Action     string `json:"action"`
+	Step       string `json:"step"`
+	Failed     bool   `json:"failed"`
+	FailedStep string `json:"failed_step,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	RolledOver bool   `json:"rolled_over"` // only known for ISM, ILM marks it in the index settings
+}
+
+// Fetches ILM data, or ISM data on OpenSearch. As Elasticsearch clusters on AWS come with Open
+// Distro ISM instead of ILM, it is tried when ILM is not available
+func GetLifecycle(ctx context.Context, client client.Versioned, openSearch bool) (*Lifecycle, error) {
+	if openSearch {
+		return getISM(ctx, client, "_plugins/_ism")
+	}
+	result, ilmErr := getILM(ctx, client)
+	if ilmErr == nil {
+		return result, nil
+	}
+	result, ismErr := getISM(ctx, client, "_opendistro/_ism")
+	if ismErr != nil {
+		return nil, fmt.Errorf("neither ILM (%v) nor ISM (%v) are available", ilmErr, ismErr)
+	}
+	return result, nil
+}
+
+type ilmExplain struct {
+	Indices map[IndexName]struct {
+		Managed    bool   `json:"managed"`
+		Policy     string `json:"policy"`
+		Phase      string `json:"phase"`
+		Action     string `json:"action"`
+		Step       string `json:"step"`
+		FailedStep string `json:"failed_step"`
+		StepInfo   struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"step_info"`
+	} `json:"indices"`
+}
+
+type ilmPolicies map[string]struct {
+	Policy struct {
+		Phases map[string]struct {
+			Actions map[string]json.RawMessage `json:"actions"`
+		} `json:"phases"`
+	} `json:"policy"`
+}
+
+func getILM(ctx context.Context, client client.Versioned) (*Lifecycle, error) {
+	explain := ilmExplain{}
+	if err := fetch.Fetch(ctx, client, "_all/_ilm/explain", &explain); err != nil {
+		return nil, err
+	}
+	policies := ilmPolicies{}
+	if err := fetch.Fetch(ctx, client, "_ilm/policy", &policies); err != nil {
+		return nil, err
+	}
+
+	result := Lifecycle{
+		System:   LifecycleILM,
+		Policies: map[string]*LifecyclePolicy{},
+		Indices:  map[IndexName]*IndexLifecycle{},
+	}
+	for name, index := range explain.Indices {
+		if !index.Managed {
+			continue
+		}
+		result.Indices[name] = &IndexLifecycle{
+			Policy:     index.Policy,
+			Phase:      index.Phase,
+			Action:     index.Action,
+			Step:       index.Step,
+			Failed:     index.Step == "ERROR",
+			FailedStep: index.FailedStep,
+			Reason:     index.StepInfo.Reason,
+		}
+	}
+	for name, policy := range policies {
+		entry := LifecyclePolicy{Name: name, Phases: []string{}}
+		for _, phase := range []string{"hot", "warm", "cold", "frozen", "delete"} {
+			if _, ok := policy.Policy.Phases[phase]; ok {
+				entry.Phases = append(entry.Phases, phase)
+			}
+		}
+		for _, phase := range policy.Policy.Phases {
+			if _, ok := phase.Actions["delete"]; ok {
+				entry.Deletes = true
+			}
+			if _, ok := phase.Actions["rollover"]; ok {
+				entry.RollsOver = true
+			}
+		}
+		result.Policies[name] = &entry
+	}
+	return &result, nil
+}
+
+type ismExplanation struct {
+	PolicyID   string `json:"policy_id"`
+	RolledOver bool   `json:"rolled_over"`
+	State      struct {
+		Name string `json:"name"`
+	} `json:"state"`
+	Action struct {
+		Name   string `json:"name"`
+		Failed bool   `json:"failed"`
+	} `json:"action"`
+	Step struct {
+		Name       string `json:"name"`
+		StepStatus string `json:"step_status"`
+	} `json:"step"`
+	RetryInfo struct {
+		Failed bool `json:"failed"`
+	} `json:"retry_info"`
+	Info struct {
+		Message string `json:"message"`
+		Cause   string `json:"cause"`
+	} `json:"info"`
+}
+
+type ismPolicies struct {
+	Policies []struct {
+		ID     string `json:"_id"`
+		Policy struct {
+			States []struct {
+				Name string `json:"name"`
+				// each action is an object keyed by the action name, along with its timeout and retry
+				Actions []map[string]json.RawMessage `json:"actions"`
+			} `json:"states"`
+		} `json:"policy"`
+	} `json:"policies"`
+}
+
+// max number of ISM policies fetched, the api pages them
+const maxISMPolicies = 1000
+
+func getISM(ctx context.Context, client client.Versioned, api string) (*Lifecycle, error) {
+	// explain responses mix the indices with a total_managed_indices counter, so they are
+	// decoded one by one
+	explain := map[string]json.RawMessage{}
+	if err := fetch.Fetch(ctx, client, api+"/explain", &explain); err != nil {
+		return nil, err
+	}
+	indices, err := parseISMExplain(explain)
+	if err != nil {
+		return nil, err
+	}
+	policies := ismPolicies{}
+	if err := fetch.Fetch(ctx, client, fmt.Sprintf("%s/policies?size=%d", api, maxISMPolicies), &policies); err != nil {
+		return nil, err
+	}
+
+	result := Lifecycle{
+		System:   LifecycleISM,
+		API:      api,
+		Policies: map[string]*LifecyclePolicy{},
+		Indices:  indices,
+	}
+	for _, policy := range policies.Policies {
+		entry := LifecyclePolicy{Name: policy.ID, Phases: []string{}}
+		for _, state := range policy.Policy.States {
+			entry.Phases = append(entry.Phases, state.Name)
+			for _, action := range state.Actions {
+				if _, ok := action["delete"]; ok {
+					entry.Deletes = true
+				}
+				if _, ok := action["rollover"]; ok {
+					entry.RollsOver = true
+				}
+			}
+		}
+		result.Policies[policy.ID] = &entry
+	}
+	return &result, nil
+}
+
+func parseISMExplain(explain map[string]json.RawMessage) (map[IndexName]*IndexLifecycle, error) {
+	result := map[IndexName]*IndexLifecycle{}
+	for name, raw := range explain {
+		if name == "total_managed_indices" {
+			continue
+		}
+		decoded := ismExplanation{}
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			return nil, fmt.Errorf("failed to json decode the ISM explanation of %s: %w", name, err)
+		}
+		if decoded.PolicyID == "" {
+			continue
+		}
+		entry := IndexLifecycle{
+			Policy:     decoded.PolicyID,
+			Phase:      decoded.State.Name,
+			Action:     decoded.Action.Name,
+			Step:       decoded.Step.Name,
+			Failed:     decoded.Action.Failed || decoded.RetryInfo.Failed || decoded.Step.StepStatus == "failed",
+			Reason:     decoded.Info.Message,
+			RolledOver: decoded.RolledOver,
+		}
+		if entry.Failed {
+			entry.FailedStep = decoded.Step.Name
+			if decoded.Info.Cause != "" {
+				entry.Reason = fmt.Sprintf("%s (%s)", entry.Reason, decoded.Info.Cause)
+			}
+		}
+		result[name] = &entry
+	}
+	return result, nil
+}
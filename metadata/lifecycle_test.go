@@ -0,0 +1,44 @@
+package metadata
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseISMExplain(t *testing.T) {
+	explain := map[string]json.RawMessage{}
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"logs-000001": {
+			"index.plugins.index_state_management.policy_id": "logs",
+			"policy_id": "logs",
+			"rolled_over": true,
+			"state": {"name": "warm"},
+			"action": {"name": "transition", "failed": false},
+			"step": {"name": "attempt_transition_step", "step_status": "completed"},
+			"retry_info": {"failed": false, "consumed_retries": 0},
+			"info": {"message": "Transitioning to delete"}
+		},
+		"logs-000002": {
+			"policy_id": "logs",
+			"state": {"name": "hot"},
+			"action": {"name": "rollover", "failed": true},
+			"step": {"name": "attempt_rollover", "step_status": "failed"},
+			"retry_info": {"failed": true, "consumed_retries": 3},
+			"info": {"message": "Missing rollover_alias index setting [index=logs-000002]"}
+		},
+		"unmanaged": {"index.plugins.index_state_management.policy_id": null},
+		"total_managed_indices": 2
+	}`), &explain))
+
+	indices, err := parseISMExplain(explain)
+	assert.NoError(t, err)
+	assert.Len(t, indices, 2)
+	assert.Equal(t, "warm", indices["logs-000001"].Phase)
+	assert.True(t, indices["logs-000001"].RolledOver)
+	assert.False(t, indices["logs-000001"].Failed)
+	assert.True(t, indices["logs-000002"].Failed)
+	assert.Equal(t, "attempt_rollover", indices["logs-000002"].FailedStep)
+	assert.Equal(t, "Missing rollover_alias index setting [index=logs-000002]", indices["logs-000002"].Reason)
+}
@@ -0,0 +1,73 @@
+package metadata
+
+import (
+	"sort"
+	"strings"
+)
+
+// Mapping counters as Elasticsearch accounts them when enforcing the index.mapping.* limits
+type MappingStats struct {
+	// object fields, leaf fields and multi-fields, as in index.mapping.total_fields.limit
+	TotalFields int `json:"total_fields"`
+	// number of inner objects of the deepest field, as in index.mapping.depth.limit. Fields at
+	// the root object have depth 1
+	MaxDepth int `json:"max_depth"`
+	// fields with the nested type, as in index.mapping.nested_fields.limit
+	NestedFields int `json:"nested_fields"`
+}
+
+func (m Mappings) Stats() MappingStats {
+	result := MappingStats{}
+	countProperties(m.Properties, 1, &result)
+	return result
+}
+
+func countProperties(properties map[PropertyName]Property, depth int, stats *MappingStats) {
+	if len(properties) > 0 && depth > stats.MaxDepth {
+		stats.MaxDepth = depth
+	}
+	for _, property := range properties {
+		stats.TotalFields++
+		stats.TotalFields += len(property.Fields)
+		if property.Type == "nested" {
+			stats.NestedFields++
+		}
+		countProperties(property.Properties, depth+1, stats)
+	}
+}
+
+// Full paths (eg "user.name" or "title.raw" for multi-fields) of the text fields with fielddata
+// enabled, sorted
+func (m Mappings) FielddataFields() []string {
+	result := []string{}
+	collectFielddataFields(m.Properties, "", &result)
+	sort.Strings(result)
+	return result
+}
+
+func collectFielddataFields(properties map[PropertyName]Property, prefix string, result *[]string) {
+	for name, property := range properties {
+		path := prefix + name
+		if property.Type == "text" && property.Fielddata {
+			*result = append(*result, path)
+		}
+		collectFielddataFields(property.Fields, path+".", result)
+		collectFielddataFields(property.Properties, path+".", result)
+	}
+}
+
+// Whether new fields are added to the mapping automatically when indexing documents. Dynamic
+// mapping is enabled by default, and "dynamic" may come either as a boolean or a string
+func (m Mappings) DynamicEnabled() bool {
+	switch v := m.Dynamic.(type) {
+	case nil:
+		return true
+	case bool:
+		return v
+	case string:
+		v = strings.ToLower(v)
+		return v != "false" && v != "strict"
+	default:
+		return true
+	}
+}
@@ -0,0 +1,68 @@
+package metadata
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMappingStats(t *testing.T) {
+	test := func(mappingJSON string, expected MappingStats) {
+		mappings := Mappings{}
+		assert.NoError(t, json.Unmarshal([]byte(mappingJSON), &mappings))
+		assert.Equal(t, expected, mappings.Stats(), "wrong stats for mapping %s", mappingJSON)
+	}
+
+	test(`{}`, MappingStats{})
+
+	test(
+		`{"properties": {"a": {"type": "keyword"}, "b": {"type": "long"}}}`,
+		MappingStats{TotalFields: 2, MaxDepth: 1},
+	)
+
+	// multi-fields count towards the total fields limit, but not towards depth
+	test(
+		`{"properties": {"title": {"type": "text", "fields": {"raw": {"type": "keyword"}}}}}`,
+		MappingStats{TotalFields: 2, MaxDepth: 1},
+	)
+
+	// object fields count as fields themselves
+	test(
+		`{"properties": {
+			"user": {"properties": {
+				"name": {"type": "keyword"},
+				"address": {"properties": {"city": {"type": "keyword"}}}
+			}},
+			"comments": {"type": "nested", "properties": {"text": {"type": "text"}}}
+		}}`,
+		MappingStats{TotalFields: 6, MaxDepth: 3, NestedFields: 1},
+	)
+}
+
+func TestMappingDynamicEnabled(t *testing.T) {
+	test := func(mappingJSON string, expected bool) {
+		mappings := Mappings{}
+		assert.NoError(t, json.Unmarshal([]byte(mappingJSON), &mappings))
+		assert.Equal(t, expected, mappings.DynamicEnabled(), "wrong dynamic for mapping %s", mappingJSON)
+	}
+
+	test(`{}`, true)
+	test(`{"dynamic": true}`, true)
+	test(`{"dynamic": "true"}`, true)
+	test(`{"dynamic": "runtime"}`, true)
+	test(`{"dynamic": false}`, false)
+	test(`{"dynamic": "false"}`, false)
+	test(`{"dynamic": "strict"}`, false)
+}
+
+func TestMappingFielddataFields(t *testing.T) {
+	mappings := Mappings{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"properties": {
+		"title": {"type": "text", "fielddata": true},
+		"body": {"type": "text"},
+		"tag": {"type": "keyword", "fields": {"text": {"type": "text", "fielddata": true}}},
+		"user": {"properties": {"name": {"type": "text", "fielddata": true}}}
+	}}`), &mappings))
+	assert.Equal(t, []string{"tag.text", "title", "user.name"}, mappings.FielddataFields())
+}
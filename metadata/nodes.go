@@ -0,0 +1,68 @@
+package metadata
+
+import (
+	"context"
+
+	"esdoctor/client"
+	"esdoctor/fetch"
+)
+
+func GetNodesInfo(ctx context.Context, client client.Versioned) (*NodesInfo, error) {
+	result := NodesInfo{}
+	return &result, fetch.Fetch(ctx, client, "_nodes", &result)
+}
+
+type NodesInfo struct {
+	ClusterName string              `json:"cluster_name"`
+	Nodes       map[NodeId]NodeInfo `json:"nodes"`
+}
+
+type NodeInfo struct {
+	Name             string            `json:"name"`
+	TransportAddress string            `json:"transport_address"`
+	Host             string            `json:"host"`
+	IP               string            `json:"ip"`
+	Version          string            `json:"version"`
+	BuildFlavor      string            `json:"build_flavor"`
+	BuildType        string            `json:"build_type"`
+	Roles            []string          `json:"roles"`
+	Attributes       map[string]string `json:"attributes"`
+	// node settings, as a tree of objects as in the elasticsearch.yml file
+	Settings map[string]interface{} `json:"settings"`
+	Os       struct {
+		Name                string `json:"name"`
+		PrettyName          string `json:"pretty_name"`
+		Arch                string `json:"arch"`
+		Version             string `json:"version"`
+		AvailableProcessors int    `json:"available_processors"`
+		AllocatedProcessors int    `json:"allocated_processors"`
+	} `json:"os"`
+	Jvm struct {
+		Pid             int    `json:"pid"`
+		Version         string `json:"version"`
+		VMName          string `json:"vm_name"`
+		VMVersion       string `json:"vm_version"`
+		VMVendor        string `json:"vm_vendor"`
+		BundledJdk      bool   `json:"bundled_jdk"`
+		UsingBundledJdk bool   `json:"using_bundled_jdk"`
+		StartTimeMillis int64  `json:"start_time_in_millis"`
+		Mem             struct {
+			HeapInitInBytes int64 `json:"heap_init_in_bytes"`
+			HeapMaxInBytes  int64 `json:"heap_max_in_bytes"`
+		} `json:"mem"`
+		GcCollectors   []string `json:"gc_collectors"`
+		InputArguments []string `json:"input_arguments"`
+	} `json:"jvm"`
+	Plugins []PluginInfo `json:"plugins"`
+	Modules []PluginInfo `json:"modules"`
+}
+
+type PluginInfo struct {
+	Name                 string `json:"name"`
+	Version              string `json:"version"`
+	ElasticsearchVersion string `json:"elasticsearch_version"`
+	OpensearchVersion    string `json:"opensearch_version"`
+	JavaVersion          string `json:"java_version"`
+	Description          string `json:"description"`
+	Classname            string `json:"classname"`
+}
@@ -0,0 +1,34 @@
+package metadata
+
+import (
+	"context"
+
+	"esdoctor/client"
+	"esdoctor/fetch"
+)
+
+// Runs the given reroute commands. ATTENTION: this changes the shard allocation of the cluster
+func Reroute(ctx context.Context, client client.Versioned, commands *RerouteCommands) (*RerouteResult, error) {
+	result := RerouteResult{}
+	return &result, fetch.FetchWithBody(ctx, client, "POST", "_cluster/reroute", commands, &result)
+}
+
+// Body of the _cluster/reroute api
+type RerouteCommands struct {
+	Commands []RerouteCommand `json:"commands"`
+}
+
+type RerouteCommand struct {
+	Move *RerouteMove `json:"move,omitempty"`
+}
+
+type RerouteMove struct {
+	Index    IndexName `json:"index"`
+	Shard    int       `json:"shard"`
+	FromNode string    `json:"from_node"`
+	ToNode   string    `json:"to_node"`
+}
+
+type RerouteResult struct {
+	Acknowledged bool `json:"acknowledged"`
+}
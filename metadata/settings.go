@@ -0,0 +1,46 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"esdoctor/client"
+	"esdoctor/fetch"
+)
+
+func GetClusterSettings(ctx context.Context, client client.Versioned) (*ClusterSettings, error) {
+	result := ClusterSettings{}
+	return &result, fetch.Fetch(ctx, client, "_cluster/settings?include_defaults=true&flat_settings=true", &result)
+}
+
+// Cluster settings in the flat format, eg "cluster.routing.allocation.awareness.attributes"
+type ClusterSettings struct {
+	Persistent map[string]interface{} `json:"persistent"`
+	Transient  map[string]interface{} `json:"transient"`
+	Defaults   map[string]interface{} `json:"defaults"`
+}
+
+// Effective value of a setting, looking into the transient, persistent and default settings in this
+// order. List settings are joined by commas. Returns an empty string for unknown settings
+func (s *ClusterSettings) Get(name string) string {
+	for _, settings := range []map[string]interface{}{s.Transient, s.Persistent, s.Defaults} {
+		value, ok := settings[name]
+		if !ok || value == nil {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			return v
+		case []interface{}:
+			values := []string{}
+			for _, item := range v {
+				values = append(values, fmt.Sprint(item))
+			}
+			return strings.Join(values, ",")
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,23 @@
+package metadata
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusterSettingsGet(t *testing.T) {
+	settings := ClusterSettings{}
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"persistent": {"cluster.routing.allocation.awareness.attributes": "zone", "indices.recovery.max_bytes_per_sec": "100mb"},
+		"transient": {"indices.recovery.max_bytes_per_sec": "200mb"},
+		"defaults": {"cluster.routing.allocation.awareness.force.zone.values": ["a", "b"], "action.auto_create_index": "true"}
+	}`), &settings))
+
+	assert.Equal(t, "zone", settings.Get("cluster.routing.allocation.awareness.attributes"))
+	assert.Equal(t, "200mb", settings.Get("indices.recovery.max_bytes_per_sec"))
+	assert.Equal(t, "a,b", settings.Get("cluster.routing.allocation.awareness.force.zone.values"))
+	assert.Equal(t, "true", settings.Get("action.auto_create_index"))
+	assert.Equal(t, "", settings.Get("foo"))
+}
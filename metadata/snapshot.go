@@ -0,0 +1,109 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"esdoctor/client"
+	"esdoctor/fetch"
+)
+
+// max number of snapshots kept per repository, the most recent ones. Repositories of long running
+// clusters may hold thousands of them
+const maxSnapshotsPerRepository = 100
+
+// Snapshot repositories along with their most recent snapshots and the SLM policies taking them
+type Snapshots struct {
+	Repositories map[string]Repository `json:"repositories"`
+	// most recent snapshots of each repository, oldest first
+	Snapshots map[string][]Snapshot `json:"snapshots"`
+	// why listing the snapshots of a repository failed, by repository
+	Errors   map[string]string         `json:"errors,omitempty"`
+	Policies map[string]SnapshotPolicy `json:"policies,omitempty"` // nil when SLM is not available
+}
+
+type Snapshot struct {
+	Snapshot          string   `json:"snapshot"`
+	UUID              string   `json:"uuid"`
+	Indices           []string `json:"indices"`
+	State             string   `json:"state"` // SUCCESS, PARTIAL, FAILED, IN_PROGRESS or INCOMPATIBLE
+	StartTimeInMillis int64    `json:"start_time_in_millis"`
+	EndTimeInMillis   int64    `json:"end_time_in_millis"`
+	Failures          []struct {
+		Index   string `json:"index"`
+		ShardID int    `json:"shard_id"`
+		NodeID  string `json:"node_id"`
+		Reason  string `json:"reason"`
+		Status  string `json:"status"`
+	} `json:"failures"`
+	Shards struct {
+		Total      int `json:"total"`
+		Failed     int `json:"failed"`
+		Successful int `json:"successful"`
+	} `json:"shards"`
+}
+
+// SLM policy, as returned by _slm/policy
+type SnapshotPolicy struct {
+	Version int `json:"version"`
+	Policy  struct {
+		Name       string `json:"name"`
+		Schedule   string `json:"schedule"`
+		Repository string `json:"repository"`
+	} `json:"policy"`
+	LastSuccess struct {
+		SnapshotName string `json:"snapshot_name"`
+		Time         int64  `json:"time"`
+	} `json:"last_success"`
+	LastFailure struct {
+		SnapshotName string `json:"snapshot_name"`
+		Time         int64  `json:"time"`
+		Details      string `json:"details"`
+	} `json:"last_failure"`
+	NextExecutionMillis int64 `json:"next_execution_millis"`
+}
+
+// Fetches the snapshot repositories and their snapshots. Failing to list the snapshots of a
+// repository is recorded rather than returned, as it is a finding in itself. When sortable, only the
+// most recent snapshots are requested, otherwise all of them are and the most recent are kept
+func GetSnapshots(ctx context.Context, client client.Versioned, sortable bool) (*Snapshots, error) {
+	result := Snapshots{
+		Repositories: map[string]Repository{},
+		Snapshots:    map[string][]Snapshot{},
+		Errors:       map[string]string{},
+	}
+	if err := fetch.Fetch(ctx, client, "_snapshot/_all", &result.Repositories); err != nil {
+		return nil, err
+	}
+
+	for name := range result.Repositories {
+		decoded := struct {
+			Snapshots []Snapshot `json:"snapshots"`
+		}{}
+		api := fmt.Sprintf("_snapshot/%s/_all", url.PathEscape(name))
+		if sortable {
+			api += fmt.Sprintf("?sort=start_time&order=desc&size=%d", maxSnapshotsPerRepository)
+		}
+		if err := fetch.Fetch(ctx, client, api, &decoded); err != nil {
+			result.Errors[name] = err.Error()
+			continue
+		}
+		snapshots := decoded.Snapshots
+		sort.SliceStable(snapshots, func(i int, j int) bool {
+			return snapshots[i].StartTimeInMillis < snapshots[j].StartTimeInMillis
+		})
+		if len(snapshots) > maxSnapshotsPerRepository {
+			snapshots = snapshots[len(snapshots)-maxSnapshotsPerRepository:]
+		}
+		result.Snapshots[name] = snapshots
+	}
+	return &result, nil
+}
+
+// Fetches the SLM policies, only available in Elasticsearch
+func GetSnapshotPolicies(ctx context.Context, client client.Versioned) (map[string]SnapshotPolicy, error) {
+	result := map[string]SnapshotPolicy{}
+	return result, fetch.Fetch(ctx, client, "_slm/policy", &result)
+}
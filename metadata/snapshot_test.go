@@ -0,0 +1,37 @@
+package metadata
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"esdoctor/client"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSnapshots(t *testing.T) {
+	test := func(sortable bool, expectedURI string) {
+		requested := []string{}
+		mock := client.Mock(func(req *http.Request, resp *http.Response) error {
+			requested = append(requested, req.URL.RequestURI())
+			body := `{"snapshots": [{"snapshot": "daily-2", "start_time_in_millis": 2}, {"snapshot": "daily-1", "start_time_in_millis": 1}]}`
+			if req.URL.Path == "/_snapshot/_all" {
+				body = `{"my backups": {"type": "fs"}}`
+			}
+			resp.Body = ioutil.NopCloser(strings.NewReader(body))
+			return nil
+		})
+
+		snapshots, err := GetSnapshots(context.Background(), mock, sortable)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/_snapshot/_all", expectedURI}, requested)
+		// oldest first either way
+		assert.Len(t, snapshots.Snapshots["my backups"], 2)
+		assert.Equal(t, "daily-1", snapshots.Snapshots["my backups"][0].Snapshot)
+	}
+	test(true, "/_snapshot/my%20backups/_all?sort=start_time&order=desc&size=100")
+	test(false, "/_snapshot/my%20backups/_all")
+}
@@ -0,0 +1,95 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+
+	"esdoctor/client"
+	"esdoctor/fetch"
+)
+
+// Composable index templates along with the component templates they are composed of. Legacy
+// templates are part of the cluster state metadata
+type IndexTemplates struct {
+	Composable map[TemplateName]ComposableTemplate `json:"composable"`
+	Components map[TemplateName]ComponentTemplate  `json:"components"`
+}
+
+type ComposableTemplate struct {
+	IndexPatterns []string               `json:"index_patterns"`
+	ComposedOf    []TemplateName         `json:"composed_of"`
+	Priority      int                    `json:"priority"`
+	Template      TemplateContent        `json:"template"`
+	DataStream    interface{}            `json:"data_stream,omitempty"` // only for data stream templates
+	Meta          map[string]interface{} `json:"_meta"`
+}
+
+type ComponentTemplate struct {
+	Template TemplateContent        `json:"template"`
+	Meta     map[string]interface{} `json:"_meta"`
+}
+
+type TemplateContent struct {
+	// flat settings, eg "index.number_of_shards"
+	Settings map[string]interface{} `json:"settings"`
+	Aliases  map[string]interface{} `json:"aliases"`
+}
+
+// Whether the template is managed by Elasticsearch itself (eg the built-in logs template)
+func (t ComposableTemplate) Managed() bool {
+	managed, _ := t.Meta["managed"].(bool)
+	return managed
+}
+
+// Effective settings of a composable template: the settings of its component templates, in order,
+// overridden by its own settings. Values are formatted as strings, as index settings are
+func (t *IndexTemplates) ResolvedSettings(name TemplateName) map[string]string {
+	result := map[string]string{}
+	template, ok := t.Composable[name]
+	if !ok {
+		return result
+	}
+	for _, componentName := range template.ComposedOf {
+		for key, value := range t.Components[componentName].Template.Settings {
+			result[key] = fmt.Sprint(value)
+		}
+	}
+	for key, value := range template.Template.Settings {
+		result[key] = fmt.Sprint(value)
+	}
+	return result
+}
+
+// Fetches the composable and component templates, available since Elasticsearch 7.8 and in OpenSearch
+func GetIndexTemplates(ctx context.Context, client client.Versioned) (*IndexTemplates, error) {
+	composable := struct {
+		IndexTemplates []struct {
+			Name          TemplateName       `json:"name"`
+			IndexTemplate ComposableTemplate `json:"index_template"`
+		} `json:"index_templates"`
+	}{}
+	if err := fetch.Fetch(ctx, client, "_index_template?flat_settings=true", &composable); err != nil {
+		return nil, err
+	}
+	components := struct {
+		ComponentTemplates []struct {
+			Name              TemplateName      `json:"name"`
+			ComponentTemplate ComponentTemplate `json:"component_template"`
+		} `json:"component_templates"`
+	}{}
+	if err := fetch.Fetch(ctx, client, "_component_template?flat_settings=true", &components); err != nil {
+		return nil, err
+	}
+
+	result := IndexTemplates{
+		Composable: map[TemplateName]ComposableTemplate{},
+		Components: map[TemplateName]ComponentTemplate{},
+	}
+	for _, template := range composable.IndexTemplates {
+		result.Composable[template.Name] = template.IndexTemplate
+	}
+	for _, template := range components.ComponentTemplates {
+		result.Components[template.Name] = template.ComponentTemplate
+	}
+	return &result, nil
+}
@@ -21,7 +21,7 @@ type Node struct {
 	Timestamp int64    `json:"timestamp"`
 	Name      string   `json:"name"`
 	Roles     []string `json:"roles"`
-	Indices   Index    `json:"indices"`
+	Indices   Lucene   `json:"indices"`
 	Os        struct {
 		Timestamp int64 `json:"timestamp"`
 		CPU       struct {
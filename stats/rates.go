@@ -0,0 +1,107 @@
+package stats
+
+import (
+	"time"
+)
+
+// Per second rates of a node, calculated from two samples of its stats
+type NodeRates struct {
+	Interval time.Duration `json:"interval_ns"`
+	// Set when the node restarted between samples, in which case no rates are calculated as the
+	// counters of the second sample start back from zero
+	Restarted bool `json:"restarted"`
+
+	IndexingPerSecond             float64                    `json:"indexing_per_second"`
+	QueriesPerSecond              float64                    `json:"queries_per_second"`
+	FetchesPerSecond              float64                    `json:"fetches_per_second"`
+	RejectionsPerSecond           float64                    `json:"rejections_per_second"`
+	ThreadPoolRejectionsPerSecond map[ThreadPoolName]float64 `json:"thread_pool_rejections_per_second"`
+	GCMillisPerSecond             float64                    `json:"gc_millis_per_second"`
+	IOOpsPerSecond                float64                    `json:"io_ops_per_second"`
+	CacheEvictionsPerSecond
+}
+
+// Per second rates of an index, calculated from two samples of its stats
+type IndexRates struct {
+	Interval time.Duration `json:"interval_ns"`
+	// Set when counters went backwards between samples (eg shards relocated to or from a node that
+	// restarted), in which case no rates are calculated
+	Reset bool `json:"reset"`
+
+	IndexingPerSecond float64 `json:"indexing_per_second"`
+	QueriesPerSecond  float64 `json:"queries_per_second"`
+	FetchesPerSecond  float64 `json:"fetches_per_second"`
+	CacheEvictionsPerSecond
+}
+
+// Per second evictions of the query cache, request cache and fielddata
+type CacheEvictionsPerSecond struct {
+	QueryCacheEvictionsPerSecond   float64 `json:"query_cache_evictions_per_second"`
+	RequestCacheEvictionsPerSecond float64 `json:"request_cache_evictions_per_second"`
+	FielddataEvictionsPerSecond    float64 `json:"fielddata_evictions_per_second"`
+}
+
+func newCacheEvictionsPerSecond(before *Lucene, after *Lucene, seconds float64) CacheEvictionsPerSecond {
+	return CacheEvictionsPerSecond{
+		QueryCacheEvictionsPerSecond:   perSecond(before.QueryCache.Evictions, after.QueryCache.Evictions, seconds),
+		RequestCacheEvictionsPerSecond: perSecond(before.RequestCache.Evictions, after.RequestCache.Evictions, seconds),
+		FielddataEvictionsPerSecond:    perSecond(before.Fielddata.Evictions, after.Fielddata.Evictions, seconds),
+	}
+}
+
+func NewNodeRates(before *Node, after *Node) *NodeRates {
+	result := NodeRates{
+		Interval:                      time.Duration(after.Timestamp-before.Timestamp) * time.Millisecond,
+		ThreadPoolRejectionsPerSecond: map[ThreadPoolName]float64{},
+	}
+	if after.Jvm.UptimeInMillis < before.Jvm.UptimeInMillis {
+		result.Restarted = true
+		return &result
+	}
+	seconds := result.Interval.Seconds()
+	if seconds <= 0 {
+		return &result
+	}
+	result.IndexingPerSecond = perSecond(before.Indices.Indexing.IndexTotal, after.Indices.Indexing.IndexTotal, seconds)
+	result.QueriesPerSecond = perSecond(before.Indices.Search.QueryTotal, after.Indices.Search.QueryTotal, seconds)
+	result.FetchesPerSecond = perSecond(before.Indices.Search.FetchTotal, after.Indices.Search.FetchTotal, seconds)
+	for name, pool := range after.ThreadPool {
+		rate := perSecond(before.ThreadPool[name].Rejected, pool.Rejected, seconds)
+		if rate > 0 {
+			result.ThreadPoolRejectionsPerSecond[name] = rate
+		}
+		result.RejectionsPerSecond += rate
+	}
+	beforeGC := before.Jvm.Gc.Collectors.Young.CollectionTimeInMillis + before.Jvm.Gc.Collectors.Old.CollectionTimeInMillis
+	afterGC := after.Jvm.Gc.Collectors.Young.CollectionTimeInMillis + after.Jvm.Gc.Collectors.Old.CollectionTimeInMillis
+	result.GCMillisPerSecond = perSecond(beforeGC, afterGC, seconds)
+	result.IOOpsPerSecond = perSecond(before.Fs.IoStats.Total.Operations, after.Fs.IoStats.Total.Operations, seconds)
+	result.CacheEvictionsPerSecond = newCacheEvictionsPerSecond(&before.Indices, &after.Indices, seconds)
+	return &result
+}
+
+func NewIndexRates(before *Index, after *Index, interval time.Duration) *IndexRates {
+	result := IndexRates{Interval: interval}
+	b, a := &before.Total, &after.Total
+	if a.Indexing.IndexTotal < b.Indexing.IndexTotal || a.Search.QueryTotal < b.Search.QueryTotal ||
+		a.Search.FetchTotal < b.Search.FetchTotal {
+		result.Reset = true
+		return &result
+	}
+	seconds := interval.Seconds()
+	if seconds <= 0 {
+		return &result
+	}
+	result.IndexingPerSecond = perSecond(b.Indexing.IndexTotal, a.Indexing.IndexTotal, seconds)
+	result.QueriesPerSecond = perSecond(b.Search.QueryTotal, a.Search.QueryTotal, seconds)
+	result.FetchesPerSecond = perSecond(b.Search.FetchTotal, a.Search.FetchTotal, seconds)
+	result.CacheEvictionsPerSecond = newCacheEvictionsPerSecond(b, a, seconds)
+	return &result
+}
+
+func perSecond(before int, after int, seconds float64) float64 {
+	if after < before {
+		return 0
+	}
+	return float64(after-before) / seconds
+}
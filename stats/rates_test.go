@@ -0,0 +1,54 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewNodeRates(t *testing.T) {
+	before := Node{Timestamp: 1000, ThreadPool: map[ThreadPoolName]ThreadPool{"write": {Rejected: 10}}}
+	before.Jvm.UptimeInMillis = 5000
+	before.Indices.Indexing.IndexTotal = 100
+	before.Jvm.Gc.Collectors.Young.CollectionTimeInMillis = 200
+
+	after := Node{Timestamp: 11000, ThreadPool: map[ThreadPoolName]ThreadPool{
+		"write":  {Rejected: 60},
+		"search": {Rejected: 0},
+	}}
+	after.Jvm.UptimeInMillis = 15000
+	after.Indices.Indexing.IndexTotal = 1100
+	after.Jvm.Gc.Collectors.Young.CollectionTimeInMillis = 700
+
+	rates := NewNodeRates(&before, &after)
+	assert.False(t, rates.Restarted)
+	assert.Equal(t, 10*time.Second, rates.Interval)
+	assert.Equal(t, 100.0, rates.IndexingPerSecond)
+	assert.Equal(t, 5.0, rates.RejectionsPerSecond)
+	assert.Equal(t, map[ThreadPoolName]float64{"write": 5}, rates.ThreadPoolRejectionsPerSecond)
+	assert.Equal(t, 50.0, rates.GCMillisPerSecond)
+
+	// counters start back from zero after a restart
+	after.Jvm.UptimeInMillis = 1000
+	after.Indices.Indexing.IndexTotal = 10
+	rates = NewNodeRates(&before, &after)
+	assert.True(t, rates.Restarted)
+	assert.Equal(t, 0.0, rates.IndexingPerSecond)
+}
+
+func TestNewIndexRates(t *testing.T) {
+	before, after := Index{}, Index{}
+	before.Total.Search.QueryTotal = 1000
+	after.Total.Search.QueryTotal = 3000
+
+	rates := NewIndexRates(&before, &after, 20*time.Second)
+	assert.False(t, rates.Reset)
+	assert.Equal(t, 100.0, rates.QueriesPerSecond)
+
+	// eg shards relocated from a node that restarted
+	after.Total.Search.QueryTotal = 500
+	rates = NewIndexRates(&before, &after, 20*time.Second)
+	assert.True(t, rates.Reset)
+	assert.Equal(t, 0.0, rates.QueriesPerSecond)
+}
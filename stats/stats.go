@@ -17,6 +17,14 @@ func GetIndices(ctx context.Context, client client.Versioned) (*Indices, error)
 	return &result, fetch.Fetch(ctx, client, "_stats?level=shards&expand_wildcards=all", &result)
 }
 
+// Fetches the store and docs stats of the closed indices, which are left out of GetIndices. Only
+// replicated closed indices (Elasticsearch 7.2 onwards) have them
+func GetClosedIndices(ctx context.Context, client client.Versioned) (*Indices, error) {
+	result := Indices{}
+	path := "_stats/store,docs?level=shards&expand_wildcards=closed&forbid_closed_indices=false"
+	return &result, fetch.Fetch(ctx, client, path, &result)
+}
+
 func GetCluster(ctx context.Context, client client.Versioned) (*Cluster, error) {
 	result := Cluster{}
 	return &result, fetch.Fetch(ctx, client, "_cluster/stats", &result)
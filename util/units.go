@@ -1,6 +1,11 @@
 package util
 
-import "strconv"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
 
 const kb float64 = 1024
 const mb float64 = kb * 1024
@@ -14,7 +19,9 @@ func HumanizeBytes(numBytes int64) string {
 
 func HumanizeBytesF(numBytes float64) string {
 	numBytesF := float64(numBytes)
-	if numBytesF < kb {
+	if numBytesF < 0 {
+		return "-" + HumanizeBytesF(-numBytesF)
+	} else if numBytesF < kb {
 		return strconv.FormatInt(int64(numBytesF), 10) + "b"
 	} else if numBytesF < mb {
 		return strconv.FormatFloat(numBytesF/kb, byte('f'), 1, 64) + "kb"
@@ -28,3 +35,54 @@ func HumanizeBytesF(numBytes float64) string {
 		return strconv.FormatFloat(numBytesF/pb, byte('f'), 1, 64) + "pb"
 	}
 }
+
+// Parses a byte size value as accepted by ES settings, eg "512mb", "1gb" or "100b"
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/api-conventions.html#byte-units
+func ParseBytes(value string) (int64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		// longer suffixes first, as "b" is a suffix of all others
+		{"pb", pb}, {"tb", tb}, {"gb", gb}, {"mb", mb}, {"kb", kb}, {"b", 1},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			number, err := strconv.ParseFloat(strings.TrimSuffix(value, unit.suffix), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid byte size %q: %w", value, err)
+			}
+			return int64(number * unit.multiplier), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid byte size %q: missing unit", value)
+}
+
+// Parses a time value as accepted by ES settings, eg "1s", "500ms" or "1d". The special value "-1"
+// (used eg to disable refreshes) is returned as a negative duration
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/api-conventions.html#time-units
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "-1" {
+		return -1, nil
+	}
+	units := []struct {
+		suffix     string
+		multiplier time.Duration
+	}{
+		// suffixes that end with other suffixes need to come first (eg "ms" ends with "s")
+		{"nanos", time.Nanosecond}, {"micros", time.Microsecond}, {"ms", time.Millisecond},
+		{"s", time.Second}, {"m", time.Minute}, {"h", time.Hour}, {"d", 24 * time.Hour},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			number, err := strconv.ParseFloat(strings.TrimSuffix(value, unit.suffix), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid time value %q: %w", value, err)
+			}
+			return time.Duration(number * float64(unit.multiplier)), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time value %q: missing unit", value)
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBytes(t *testing.T) {
+	test := func(input string, expected int64) {
+		got, err := ParseBytes(input)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, got, "ParseBytes(%q) should be %d but got %d instead", input, expected, got)
+	}
+	test("0b", 0)
+	test("100b", 100)
+	test("1kb", 1024)
+	test("512mb", 512*1024*1024)
+	test("1.5gb", 1536*1024*1024)
+	test(" 2TB ", 2*1024*1024*1024*1024)
+
+	for _, input := range []string{"", "foo", "100", "mb", "1.2.3gb"} {
+		_, err := ParseBytes(input)
+		assert.Error(t, err, "ParseBytes(%q) should fail", input)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	test := func(input string, expected time.Duration) {
+		got, err := ParseDuration(input)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, got, "ParseDuration(%q) should be %v but got %v instead", input, expected, got)
+	}
+	test("-1", -1)
+	test("100nanos", 100*time.Nanosecond)
+	test("100micros", 100*time.Microsecond)
+	test("500ms", 500*time.Millisecond)
+	test("1s", time.Second)
+	test("30s", 30*time.Second)
+	test("5m", 5*time.Minute)
+	test("12h", 12*time.Hour)
+	test("7d", 7*24*time.Hour)
+
+	for _, input := range []string{"", "foo", "100", "s", "1x"} {
+		_, err := ParseDuration(input)
+		assert.Error(t, err, "ParseDuration(%q) should fail", input)
+	}
+}
+
+func TestHumanizeBytes(t *testing.T) {
+	assert.Equal(t, "100b", HumanizeBytes(100))
+	assert.Equal(t, "1.5kb", HumanizeBytes(1536))
+	assert.Equal(t, "2.0gb", HumanizeBytes(2*1024*1024*1024))
+	assert.Equal(t, "-1.5mb", HumanizeBytesF(-1.5*1024*1024))
+}
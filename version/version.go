@@ -12,11 +12,19 @@ import (
 	"esdoctor/client"
 )
 
+// Distribution of clusters running OpenSearch. It is empty for Elasticsearch
+const DistributionOpenSearch = "opensearch"
+
 // ES uses semantic versioning https://semver.org/
 type ESVersion struct {
-	Major int `json:"major"`
-	Minor int `json:"minor"`
-	Patch int `json:"patch"`
+	Major        int    `json:"major"`
+	Minor        int    `json:"minor"`
+	Patch        int    `json:"patch"`
+	Distribution string `json:"distribution,omitempty"`
+}
+
+func (v ESVersion) OpenSearch() bool {
+	return v.Distribution == DistributionOpenSearch
 }
 
 func (v ESVersion) Set() bool {
@@ -24,7 +32,7 @@ func (v ESVersion) Set() bool {
 }
 
 func (v ESVersion) String() string {
-	return fmt.Sprintf("%d.%d.%d", v.Major, v.Major, v.Patch)
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
 }
 
 func (v ESVersion) MarshalJSON() ([]byte, error) {
@@ -60,7 +68,8 @@ func Discover(ctx context.Context, client client.Versioned) (ESVersion, error) {
 
 	var decoded struct {
 		Version struct {
-			Number string `json:"number"`
+			Number       string `json:"number"`
+			Distribution string `json:"distribution"`
 		} `json:"version"`
 	}
 
@@ -77,6 +86,7 @@ func Discover(ctx context.Context, client client.Versioned) (ESVersion, error) {
 	if err != nil {
 		return errResult(err)
 	}
+	result.Distribution = decoded.Version.Distribution
 	return result, nil
 }
 
@@ -103,3 +113,24 @@ func Parse(version string) (ESVersion, error) {
 		Patch: patch,
 	}, nil
 }
+
+// OpenSearch flips this bit of its version ids to tell them apart from Elasticsearch ones
+const openSearchVersionIDMask = 0x08000000
+
+// Parses version ids, as in the index.version.created setting. Ids are built as
+// major*1000000 + minor*10000 + patch*100 + build, eg 7100099 for 7.10.0
+func ParseID(id string) (ESVersion, error) {
+	number, err := strconv.Atoi(id)
+	if err != nil || number <= 0 {
+		return ESVersion{}, fmt.Errorf("invalid version id %q", id)
+	}
+	result := ESVersion{}
+	if number&openSearchVersionIDMask != 0 {
+		number ^= openSearchVersionIDMask
+		result.Distribution = DistributionOpenSearch
+	}
+	result.Major = number / 1000000
+	result.Minor = number / 10000 % 100
+	result.Patch = number / 100 % 100
+	return result, nil
+}
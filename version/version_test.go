@@ -73,6 +73,45 @@ func TestDiscover7(t *testing.T) {
 	)
 }
 
+func TestDiscoverOpenSearch(t *testing.T) {
+	testDiscover(
+		t, ESVersion{Major: 1, Minor: 3, Patch: 2, Distribution: DistributionOpenSearch},
+		` {
+			"name": "node-0",
+			"cluster_name": "opensearch-dev",
+			"cluster_uuid": "tg0SOBaTQvOsGd8PgOmVyQ",
+			"version": {
+			  "distribution": "opensearch",
+			  "number": "1.3.2",
+			  "build_type": "tar",
+			  "build_hash": "6febb2b6f95b4b8ac5d0b89e0fcbd2a1c8a1b542",
+			  "build_date": "2022-05-04T06:53:45.164849Z",
+			  "build_snapshot": false,
+			  "lucene_version": "8.10.1",
+			  "minimum_wire_compatibility_version": "6.8.0",
+			  "minimum_index_compatibility_version": "6.0.0-beta1"
+			},
+			"tagline": "The OpenSearch Project: https://opensearch.org/"
+		  }`,
+	)
+}
+
+func TestParseID(t *testing.T) {
+	test := func(id string, expected ESVersion) {
+		got, err := ParseID(id)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, got, "ParseID(%q) should be %v but got %v instead", id, expected, got)
+	}
+	test("7100099", ESVersion{Major: 7, Minor: 10, Patch: 0})
+	test("6080499", ESVersion{Major: 6, Minor: 8, Patch: 4})
+	test("135217827", ESVersion{Major: 1, Minor: 0, Patch: 0, Distribution: DistributionOpenSearch})
+
+	for _, input := range []string{"", "foo", "-1"} {
+		_, err := ParseID(input)
+		assert.Error(t, err, "ParseID(%q) should fail", input)
+	}
+}
+
 func testDiscover(t *testing.T, expectedVersion ESVersion, getRootResult string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()